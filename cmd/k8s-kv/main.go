@@ -0,0 +1,379 @@
+// Command k8s-kv inspects and edits k8s-kv buckets. Bucket data is stored compressed and encoded
+// inside config maps so "kubectl get cm -o yaml" is not much help, this tool decodes it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rusenask/k8s-kv/kv"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	core_v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `Usage: k8s-kv [flags] <command> [args]
+
+Commands:
+  get <key>            print value of the key
+  put <key> <value>    store value under the key, use "-" to read value from stdin
+  delete <key>         remove key from the bucket
+  list [prefix]        list keys (and values) under prefix
+  dump                 print all key/value pairs
+  import <file>        import key/value pairs from JSON or YAML file ("-" for stdin)
+  create               create empty bucket (fails if it already exists)
+  teardown             delete bucket config map (requires --yes)
+  stats                print bucket size statistics
+  buckets              list k8s-kv buckets in the namespace
+
+Flags:
+`
+
+type options struct {
+	kubeconfig string
+	namespace  string
+	app        string
+	bucket     string
+	output     string
+	yes        bool
+	// schema is a JSON schema file values written by put and import are validated against
+	schema       string
+	schemaPrefix string
+}
+
+func main() {
+	var opts options
+
+	fs := flag.NewFlagSet("k8s-kv", flag.ExitOnError)
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", filepath.Join(os.Getenv("HOME"), ".kube", "config"), "path to kubeconfig file")
+	fs.StringVar(&opts.namespace, "namespace", "default", "namespace of the bucket")
+	fs.StringVar(&opts.app, "app", "", "app name (used as a label when creating buckets and to filter buckets)")
+	fs.StringVar(&opts.bucket, "bucket", "", "bucket name")
+	fs.StringVar(&opts.output, "o", "json", "output format: json, yaml or raw")
+	fs.BoolVar(&opts.yes, "yes", false, "confirm destructive operations")
+	fs.StringVar(&opts.schema, "schema", "", "JSON schema file, values written by put and import have to be valid against it")
+	fs.StringVar(&opts.schemaPrefix, "schema-prefix", "", "validate only keys with this prefix against --schema")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(opts, fs.Arg(0), fs.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func getImplementer(opts options) (core_v1.ConfigMapInterface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", opts.kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CoreV1().ConfigMaps(opts.namespace), nil
+}
+
+func run(opts options, command string, args []string) error {
+	switch opts.output {
+	case "json", "yaml", "raw":
+	default:
+		return fmt.Errorf("unknown output format '%s'", opts.output)
+	}
+
+	impl, err := getImplementer(opts)
+	if err != nil {
+		return err
+	}
+
+	if command == "buckets" {
+		return listBuckets(impl, opts)
+	}
+
+	if opts.bucket == "" {
+		return fmt.Errorf("--bucket is required")
+	}
+
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: get <key>")
+		}
+		return get(impl, opts, args[0])
+	case "put":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: put <key> <value>")
+		}
+		return put(impl, opts, args[0], args[1])
+	case "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete <key>")
+		}
+		return del(impl, opts, args[0])
+	case "list":
+		prefix := ""
+		if len(args) > 0 {
+			prefix = args[0]
+		}
+		return list(impl, opts, prefix)
+	case "dump":
+		return list(impl, opts, "")
+	case "import":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: import <file>")
+		}
+		return importFile(impl, opts, args[0])
+	case "create":
+		return create(impl, opts)
+	case "teardown":
+		return teardown(impl, opts)
+	case "stats":
+		return stats(impl, opts)
+	}
+
+	return fmt.Errorf("unknown command '%s'", command)
+}
+
+// readBucket decodes bucket contents straight from the config map, read only commands
+// shouldn't create missing buckets as kv.New would.
+func readBucket(impl core_v1.ConfigMapInterface, opts options) (map[string][]byte, error) {
+	cfgMap, err := impl.Get(opts.bucket, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return kv.DecodeConfigMap(cfgMap)
+}
+
+func get(impl core_v1.ConfigMapInterface, opts options, key string) error {
+	data, err := readBucket(impl, opts)
+	if err != nil {
+		return err
+	}
+
+	val, ok := data[key]
+	if !ok {
+		return kv.ErrNotFound
+	}
+
+	if opts.output == "raw" {
+		_, err = stdout.Write(val)
+		return err
+	}
+
+	return printValue(opts.output, map[string]string{key: encodeValue(val)})
+}
+
+func put(impl core_v1.ConfigMapInterface, opts options, key, value string) error {
+	val := []byte(value)
+	if value == "-" {
+		var err error
+		val, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	kvOpts, err := validators(opts)
+	if err != nil {
+		return err
+	}
+
+	kvdb, err := kv.New(impl, opts.app, opts.bucket, kvOpts...)
+	if err != nil {
+		return err
+	}
+
+	return kvdb.Put(key, val)
+}
+
+// validators returns options that register validators requested with flags.
+func validators(opts options) ([]kv.Option, error) {
+	if opts.schema == "" {
+		return nil, nil
+	}
+
+	schema, err := ioutil.ReadFile(opts.schema)
+	if err != nil {
+		return nil, err
+	}
+	validator, err := kv.JSONSchemaValidator(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema '%s': %s", opts.schema, err)
+	}
+	return []kv.Option{kv.WithValidator(opts.schemaPrefix, validator)}, nil
+}
+
+func del(impl core_v1.ConfigMapInterface, opts options, key string) error {
+	// deleting from a missing bucket shouldn't create it
+	kvdb, err := kv.New(impl, opts.app, opts.bucket, kv.WithStrict())
+	if err != nil {
+		return err
+	}
+
+	return kvdb.Delete(key)
+}
+
+func list(impl core_v1.ConfigMapInterface, opts options, prefix string) error {
+	stored, err := readBucket(impl, opts)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]string)
+	for key, val := range stored {
+		if strings.HasPrefix(key, prefix) {
+			data[key] = encodeValue(val)
+		}
+	}
+
+	if opts.output == "raw" {
+		for _, key := range sortedKeys(data) {
+			fmt.Fprintln(stdout, key)
+		}
+		return nil
+	}
+
+	return printValue(opts.output, data)
+}
+
+func importFile(impl core_v1.ConfigMapInterface, opts options, path string) error {
+	var (
+		bts []byte
+		err error
+	)
+	if path == "-" {
+		bts, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		bts, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseEntries(bts)
+	if err != nil {
+		return fmt.Errorf("failed to parse '%s': %s", path, err)
+	}
+
+	kvOpts, err := validators(opts)
+	if err != nil {
+		return err
+	}
+
+	kvdb, err := kv.New(impl, opts.app, opts.bucket, kvOpts...)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string][]byte, len(entries))
+	for key, val := range entries {
+		data[key], err = decodeValue(val)
+		if err != nil {
+			return fmt.Errorf("failed to decode value of '%s': %s", key, err)
+		}
+	}
+
+	return kvdb.PutMany(data)
+}
+
+func create(impl core_v1.ConfigMapInterface, opts options) error {
+	kvdb, err := kv.CreateBucket(impl, opts.app, opts.bucket)
+	if err != nil {
+		return err
+	}
+	return kvdb.Close()
+}
+
+func teardown(impl core_v1.ConfigMapInterface, opts options) error {
+	if !opts.yes {
+		return fmt.Errorf("teardown deletes all data in bucket '%s', pass --yes to confirm", opts.bucket)
+	}
+
+	kvdb, err := kv.New(impl, opts.app, opts.bucket, kv.WithStrict())
+	if err != nil {
+		return err
+	}
+	defer kvdb.Close()
+
+	return kvdb.Teardown()
+}
+
+type bucketStats struct {
+	Bucket      string  `json:"bucket"`
+	Keys        int     `json:"keys"`
+	ValueBytes  int     `json:"valueBytes"`
+	EncodedSize int     `json:"encodedSize"`
+	Ratio       float64 `json:"compressionRatio"`
+	LimitUsed   float64 `json:"limitUsedPercent"`
+}
+
+func stats(impl core_v1.ConfigMapInterface, opts options) error {
+	cfgMap, err := impl.Get(opts.bucket, meta_v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	data, err := kv.DecodeConfigMap(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	s := bucketStats{
+		Bucket: opts.bucket,
+		Keys:   len(data),
+	}
+	for key, val := range data {
+		s.ValueBytes += len(key) + len(val)
+	}
+	for _, val := range cfgMap.Data {
+		s.EncodedSize += len(val)
+	}
+	if s.EncodedSize > 0 {
+		s.Ratio = float64(s.ValueBytes) / float64(s.EncodedSize)
+	}
+	s.LimitUsed = float64(s.EncodedSize) / kv.MaxBucketSize * 100
+
+	if opts.output == "raw" {
+		fmt.Fprintf(stdout, "bucket:\t%s\nkeys:\t%d\nvalue bytes:\t%d\nencoded size:\t%d\ncompression ratio:\t%.2f\nlimit used:\t%.2f%%\n",
+			s.Bucket, s.Keys, s.ValueBytes, s.EncodedSize, s.Ratio, s.LimitUsed)
+		return nil
+	}
+
+	return printValue(opts.output, s)
+}
+
+func listBuckets(impl core_v1.ConfigMapInterface, opts options) error {
+	buckets, err := kv.ListBuckets(impl, opts.app)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == "raw" {
+		for _, b := range buckets {
+			if b.Corrupted {
+				fmt.Fprintf(stdout, "%s\t%s\tcorrupted\t%d bytes\n", b.Name, b.App, b.Size)
+				continue
+			}
+			fmt.Fprintf(stdout, "%s\t%s\t%d keys\t%d bytes\n", b.Name, b.App, b.Keys, b.Size)
+		}
+		return nil
+	}
+
+	return printValue(opts.output, buckets)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rusenask/k8s-kv/kv"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDumpImportRoundTrip(t *testing.T) {
+	values := map[string][]byte{
+		"text":   []byte("plain value"),
+		"binary": {0xff, 0x00, 0xfe, 0x81, 'a'},
+		"prefix": []byte(binaryPrefix + "not really base64"),
+		"empty":  {},
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+		src, err := kv.New(impl, "app", "src")
+		if err != nil {
+			t.Fatalf("failed to get kv: %s", err)
+		}
+		if err := src.PutMany(values); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+
+		var buf bytes.Buffer
+		stdout = &buf
+		err = list(impl, options{bucket: "src", output: format}, "")
+		stdout = os.Stdout
+		if err != nil {
+			t.Fatalf("failed to dump %s: %s", format, err)
+		}
+
+		dir, err := ioutil.TempDir("", "k8s-kv")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+		backup := filepath.Join(dir, "backup."+format)
+		if err := ioutil.WriteFile(backup, buf.Bytes(), 0600); err != nil {
+			t.Fatalf("failed to write backup: %s", err)
+		}
+
+		if err := importFile(impl, options{app: "app", bucket: "dst"}, backup); err != nil {
+			t.Fatalf("failed to import %s: %s", format, err)
+		}
+
+		imported, err := readBucket(impl, options{bucket: "dst"})
+		if err != nil {
+			t.Fatalf("failed to read imported bucket: %s", err)
+		}
+		if len(imported) != len(values) {
+			t.Errorf("%s: expected %d keys, got %d", format, len(values), len(imported))
+		}
+		for key, val := range values {
+			if !bytes.Equal(imported[key], val) {
+				t.Errorf("%s: key '%s' expected %v, got %v", format, key, val, imported[key])
+			}
+		}
+	}
+}
+
+func TestImportSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8s-kv")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	schema := filepath.Join(dir, "user.json")
+	err = ioutil.WriteFile(schema, []byte(`{"type": "object", "required": ["name"]}`), 0600)
+	if err != nil {
+		t.Fatalf("failed to write schema: %s", err)
+	}
+	entries := filepath.Join(dir, "users.yaml")
+	err = ioutil.WriteFile(entries, []byte("users/john: '{\"name\": \"john\"}'\nusers/bad: '{}'\nconfig: not json\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write entries: %s", err)
+	}
+
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	opts := options{app: "app", bucket: "b1", schema: schema, schemaPrefix: "users/"}
+
+	err = importFile(impl, opts, entries)
+	if _, ok := err.(*kv.ValidationError); !ok {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+	data, err := readBucket(impl, opts)
+	if err != nil {
+		t.Fatalf("failed to read bucket: %s", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected nothing to be imported, got: %v", data)
+	}
+
+	err = ioutil.WriteFile(entries, []byte("users/john: '{\"name\": \"john\"}'\nconfig: not json\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write entries: %s", err)
+	}
+	if err := importFile(impl, opts, entries); err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"sigs.k8s.io/yaml"
+)
+
+// stdout is where command output goes, replaced in tests
+var stdout io.Writer = os.Stdout
+
+// binaryPrefix marks base64 encoded values in JSON and YAML output. Values that aren't valid UTF-8
+// (ie: gob encoded) can't be printed as strings without losing data.
+const binaryPrefix = "base64:"
+
+// encodeValue returns value as a string that survives JSON/YAML round trip, decodeValue reverses it.
+// Values that happen to start with binaryPrefix are encoded too so they aren't decoded on import.
+func encodeValue(val []byte) string {
+	if utf8.Valid(val) && !bytes.HasPrefix(val, []byte(binaryPrefix)) {
+		return string(val)
+	}
+	return binaryPrefix + base64.StdEncoding.EncodeToString(val)
+}
+
+func decodeValue(val string) ([]byte, error) {
+	if !strings.HasPrefix(val, binaryPrefix) {
+		return []byte(val), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(val, binaryPrefix))
+}
+
+// printValue writes value to stdout in JSON or YAML format.
+func printValue(format string, value interface{}) error {
+	var (
+		bts []byte
+		err error
+	)
+	switch format {
+	case "yaml":
+		bts, err = yaml.Marshal(value)
+	default:
+		bts, err = json.MarshalIndent(value, "", "  ")
+		bts = append(bts, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(bts)
+	return err
+}
+
+// parseEntries parses key/value pairs from a JSON or YAML document, YAML being a superset of JSON.
+func parseEntries(bts []byte) (map[string]string, error) {
+	entries := make(map[string]string)
+	if err := yaml.Unmarshal(bts, &entries); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entries found")
+	}
+	return entries, nil
+}
+
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
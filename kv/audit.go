@@ -0,0 +1,238 @@
+package kv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// AuditRecord describes a single mutation of a bucket.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	App    string    `json:"app"`
+	Bucket string    `json:"bucket"`
+	// Namespace and UID of bucket's config map as the mutation left it
+	Namespace string    `json:"namespace,omitempty"`
+	BucketUID types.UID `json:"bucketUID,omitempty"`
+	Op        Op        `json:"op"`
+	// Key is the mutated key, prefix for delete_tree, source bucket for merge and empty for teardown
+	Key string `json:"key,omitempty"`
+	// ValueHash is hex encoded SHA-256 of the written value, empty for deletes
+	ValueHash string `json:"valueHash,omitempty"`
+	// Identity of the caller, see WithAudit and ContextWithIdentity
+	Identity string `json:"identity,omitempty"`
+}
+
+// AuditSink receives audit records. Records are sent after mutation succeeded and bucket's lock was
+// released, sinks are responsible for handling their own failures.
+type AuditSink interface {
+	Record(rec AuditRecord)
+}
+
+// batchAuditSink is implemented by sinks that store all records of a single operation at once.
+type batchAuditSink interface {
+	recordBatch(recs []AuditRecord)
+}
+
+// AuditSinkFunc adapts a function to AuditSink, it's an easy way to plug in slog, logr or any other logger.
+type AuditSinkFunc func(rec AuditRecord)
+
+// Record implements AuditSink.
+func (f AuditSinkFunc) Record(rec AuditRecord) {
+	f(rec)
+}
+
+// WithAudit records every Put, PutMany, Incr, Delete, DeleteTree and Teardown to the sink. Identity is used
+// as the caller identity unless a different one is set on the context with ContextWithIdentity.
+func WithAudit(sink AuditSink, identity string) Option {
+	return func(c *config) {
+		c.auditSink = sink
+		c.auditIdentity = identity
+	}
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity sets caller identity for audit records of operations done through KV.WithContext(ctx).
+func ContextWithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// audit sends record of the mutation to audit sink (if there is one). It has to be called after k.mu
+// is released: sinks may write to other buckets, including ones that audit into this bucket.
+func (k *KV) audit(op Op, key string, value []byte) {
+	if k.auditSink == nil {
+		return
+	}
+	k.sendAudit([]AuditRecord{k.auditRecord(op, key, value)})
+}
+
+// auditMany sends records of mutations of all keys in data to audit sink, nil values are deletes. Same
+// as audit, k.mu must not be held.
+func (k *KV) auditMany(op Op, data map[string][]byte) {
+	if k.auditSink == nil || len(data) == 0 {
+		return
+	}
+	recs := make([]AuditRecord, 0, len(data))
+	for _, key := range sortedKeys(data, "") {
+		recs = append(recs, k.auditRecord(op, key, data[key]))
+	}
+	k.sendAudit(recs)
+}
+
+func (k *KV) sendAudit(recs []AuditRecord) {
+	if sink, ok := k.auditSink.(batchAuditSink); ok {
+		sink.recordBatch(recs)
+		return
+	}
+	for _, rec := range recs {
+		k.auditSink.Record(rec)
+	}
+}
+
+func (k *KV) auditRecord(op Op, key string, value []byte) AuditRecord {
+	observed := k.lastObserved()
+	rec := AuditRecord{
+		Time:      time.Now(),
+		App:       k.app,
+		Bucket:    k.bucket,
+		Namespace: observed.Namespace,
+		BucketUID: observed.UID,
+		Op:        op,
+		Key:       key,
+		Identity:  k.auditIdentity,
+	}
+	if identity, ok := k.ctx.Value(identityKey{}).(string); ok {
+		rec.Identity = identity
+	}
+	if value != nil {
+		sum := sha256.Sum256(value)
+		rec.ValueHash = hex.EncodeToString(sum[:])
+	}
+	return rec
+}
+
+// LogAuditSink writes audit records to the logger as JSON.
+func LogAuditSink(logger Logger) AuditSink {
+	return AuditSinkFunc(func(rec AuditRecord) {
+		bts, _ := json.Marshal(rec)
+		logger.Printf("k8s-kv audit: %s", bts)
+	})
+}
+
+// auditKeyLayout is a sortable time layout used for keys of audit records
+const auditKeyLayout = "20060102T150405.000000000Z"
+
+// BucketAuditSink stores audit records as JSON in a bucket, keys are record timestamps so they are
+// sorted chronologically. Once there are more than maxRecords records, the oldest ones are removed
+// to keep the bucket under config map size limit. Audit bucket must not be the audited bucket itself.
+// Records of a single operation (ie: all keys of PutMany) are stored with a single update. Records that
+// can't be stored are counted as failed "audit" operations of the audit bucket (see WithMetrics) and
+// reported with AuditFailed warning events (see WithEventRecorder).
+func BucketAuditSink(kv *KV, maxRecords int) AuditSink {
+	return &bucketAuditSink{kv: kv, maxRecords: maxRecords}
+}
+
+type bucketAuditSink struct {
+	kv         *KV
+	maxRecords int
+}
+
+// Record implements AuditSink.
+func (s *bucketAuditSink) Record(rec AuditRecord) {
+	s.recordBatch([]AuditRecord{rec})
+}
+
+func (s *bucketAuditSink) recordBatch(recs []AuditRecord) {
+	if err := s.store(recs); err != nil {
+		s.kv.event(s.kv.lastObserved(), v1.EventTypeWarning, ReasonAuditFailed, "failed to store %d audit records of %s in bucket '%s': %s",
+			len(recs), recs[0].Op, recs[0].Bucket, err)
+	}
+}
+
+func (s *bucketAuditSink) store(recs []AuditRecord) (err error) {
+	ctx, end := s.kv.start(OpAudit)
+	defer end(&err)
+
+	encoded := make([][]byte, len(recs))
+	for i, rec := range recs {
+		encoded[i], err = json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.kv.mu.Lock()
+	defer s.kv.mu.Unlock()
+
+	return s.kv.update(ctx, func(im map[string][]byte) error {
+		for i, rec := range recs {
+			ts := rec.Time.UTC().Format(auditKeyLayout)
+			key := ts
+			for n := 1; ; n++ {
+				if _, ok := im[key]; !ok {
+					break
+				}
+				key = fmt.Sprintf("%s-%d", ts, n)
+			}
+			im[key] = encoded[i]
+		}
+
+		if s.maxRecords > 0 && len(im) > s.maxRecords {
+			keys := sortedKeys(im, "")
+			for _, old := range keys[:len(keys)-s.maxRecords] {
+				delete(im, old)
+			}
+		}
+		return nil
+	})
+}
+
+// EventAuditSink emits audit records as Kubernetes Events on bucket's config map.
+func EventAuditSink(recorder EventRecorder) AuditSink {
+	return AuditSinkFunc(func(rec AuditRecord) {
+		cfgMap := &v1.ConfigMap{ObjectMeta: meta_v1.ObjectMeta{Name: rec.Bucket, Namespace: rec.Namespace, UID: rec.BucketUID}}
+		recorder.Eventf(bucketObjectRef(cfgMap), v1.EventTypeNormal, "Bucket"+opReason(rec.Op),
+			"%s '%s' by '%s' (value sha256: %s)", rec.Op, rec.Key, rec.Identity, rec.ValueHash)
+	})
+}
+
+// opReason turns operation name into UpperCamelCase event reason, ie: put_many -> PutMany.
+func opReason(op Op) string {
+	reason := []byte(op)
+	upper := true
+	out := reason[:0]
+	for _, c := range reason {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// ReadAuditRecords returns records stored by BucketAuditSink in chronological order.
+func ReadAuditRecords(kv *KV) ([]AuditRecord, error) {
+	it := kv.Iterate("")
+	var records []AuditRecord
+	for it.Next() {
+		var rec AuditRecord
+		if err := json.Unmarshal(it.Value(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to decode audit record '%s': %s", it.Key(), err)
+		}
+		records = append(records, rec)
+	}
+	return records, it.Err()
+}
@@ -0,0 +1,237 @@
+package kv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeRecorder struct {
+	events []string
+	uids   []types.UID
+}
+
+func (r *fakeRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	cfgMap := object.(*v1.ConfigMap)
+	r.events = append(r.events, fmt.Sprintf("%s/%s %s %s", cfgMap.Namespace, cfgMap.Name, eventtype, reason))
+	r.uids = append(r.uids, cfgMap.UID)
+}
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(rec AuditRecord) {
+		records = append(records, rec)
+	})
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithAudit(sink, "pod-a"))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	kv.Get("foo")
+	ctx := ContextWithIdentity(context.Background(), "john")
+	if err := kv.WithContext(ctx).Delete("foo"); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got: %d", len(records))
+	}
+
+	sum := sha256.Sum256([]byte("bar"))
+	put := records[0]
+	if put.Op != OpPut || put.Key != "foo" || put.Bucket != "b1" || put.Identity != "pod-a" {
+		t.Errorf("unexpected put record: %+v", put)
+	}
+	if put.ValueHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected value hash: %s", put.ValueHash)
+	}
+
+	del := records[1]
+	if del.Op != OpDelete || del.Identity != "john" || del.ValueHash != "" {
+		t.Errorf("unexpected delete record: %+v", del)
+	}
+}
+
+func TestBucketAuditSink(t *testing.T) {
+	auditBucket, err := New(&fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}, "app", "audit")
+	if err != nil {
+		t.Fatalf("failed to get audit kv: %s", err)
+	}
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithAudit(BucketAuditSink(auditBucket, 3), "pod-a"))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := kv.Put(fmt.Sprintf("key-%d", i), []byte("val")); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	records, err := ReadAuditRecords(auditBucket)
+	if err != nil {
+		t.Fatalf("failed to read audit records: %s", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records to be kept, got: %d", len(records))
+	}
+	if records[0].Key != "key-2" || records[2].Key != "key-4" {
+		t.Errorf("expected oldest records to be removed, got: %+v", records)
+	}
+}
+
+func TestEventAuditSink(t *testing.T) {
+	recorder := &fakeRecorder{}
+	kv, err := New(newFakeAPIServer(), "app", "b1", WithAudit(EventAuditSink(recorder), "pod-a"))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	kv.PutMany(map[string][]byte{"a": []byte("1")})
+	kv.Teardown()
+
+	expected := []string{
+		"default/b1 Normal BucketPutMany",
+		"default/b1 Normal BucketTeardown",
+	}
+	if fmt.Sprint(recorder.events) != fmt.Sprint(expected) {
+		t.Errorf("unexpected events: %v", recorder.events)
+	}
+	for i, uid := range recorder.uids {
+		if uid != "uid-1" {
+			t.Errorf("event %s references UID '%s'", recorder.events[i], uid)
+		}
+	}
+}
+
+func TestBucketAuditSinkFailure(t *testing.T) {
+	metrics := NewMetrics()
+	recorder := &fakeRecorder{}
+	auditImpl := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "audit", Namespace: "default", UID: "uid-1"},
+			Data:       map[string]string{},
+		},
+	}
+	auditBucket, err := New(auditImpl, "app", "audit", WithMetrics(metrics), WithEventRecorder(recorder))
+	if err != nil {
+		t.Fatalf("failed to get audit kv: %s", err)
+	}
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithAudit(BucketAuditSink(auditBucket, 0), "pod-a"))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	auditImpl.updateErrs = []error{ErrBucketTooLarge}
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	if v := testutil.ToFloat64(metrics.operationErrors.WithLabelValues("audit", string(OpAudit))); v != 1 {
+		t.Errorf("expected failed audit to be counted, got: %v", v)
+	}
+	if len(recorder.events) != 1 || recorder.events[0] != "default/audit Warning AuditFailed" || recorder.uids[0] != "uid-1" {
+		t.Errorf("unexpected events: %v", recorder.events)
+	}
+}
+
+// countingUpdates counts config map updates.
+type countingUpdates struct {
+	ConfigMapInterface
+	updates int
+}
+
+func (c *countingUpdates) Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	c.updates++
+	return c.ConfigMapInterface.Update(cfgMap)
+}
+
+func TestBucketAuditSinkBatch(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	auditImpl := &countingUpdates{ConfigMapInterface: impl}
+	auditBucket, _ := New(auditImpl, "app", "audit")
+	kv, _ := New(impl, "app", "b1", WithAudit(BucketAuditSink(auditBucket, 0), "pod-a"))
+
+	data := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprintf("key-%03d", i)] = []byte("val")
+	}
+	if err := kv.PutMany(data); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	if auditImpl.updates != 1 {
+		t.Errorf("expected records to be stored with a single update, got %d", auditImpl.updates)
+	}
+	records, _ := ReadAuditRecords(auditBucket)
+	if len(records) != 100 || records[0].Key != "key-000" || records[99].Key != "key-099" {
+		t.Errorf("unexpected records: %d", len(records))
+	}
+}
+
+func TestBucketsAuditIntoEachOther(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	a, _ := New(impl, "app", "a")
+	b, _ := New(impl, "app", "b")
+	a.auditSink = BucketAuditSink(b, 10)
+	b.auditSink = BucketAuditSink(a, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for _, kv := range []*KV{a, b} {
+			wg.Add(1)
+			go func(kv *KV) {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					kv.Put(fmt.Sprintf("key-%d", i), []byte("val"))
+				}
+			}(kv)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("buckets auditing into each other deadlocked")
+	}
+}
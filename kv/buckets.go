@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"sort"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+)
+
+// BucketInfo describes a k8s-kv bucket found in the namespace.
+type BucketInfo struct {
+	Name string
+	App  string
+	// Size is the size of encoded bucket data in bytes, counting against the 1MB config map limit
+	Size int
+	// Keys is the number of keys stored in the bucket
+	Keys int
+	// Corrupted is set when bucket data can't be decoded, see KV.Repair
+	Corrupted bool
+}
+
+// ListBuckets returns all k8s-kv buckets that belong to the app, buckets are discovered by the labels
+// applied when they were created. If app is empty - buckets of all apps are returned.
+func ListBuckets(implementer ConfigMapInterface, app string) ([]BucketInfo, error) {
+	return listBuckets(implementer, app, DefaultSerializer())
+}
+
+func listBuckets(implementer ConfigMapInterface, app string, serializer Serializer) ([]BucketInfo, error) {
+	var set labels
+	set.init()
+	set.set(labelManagedBy, managedByK8SKV)
+	if app != "" {
+		set.set(labelApp, app)
+	}
+
+	// buckets created by older versions only have legacy labels
+	var legacySet labels
+	legacySet.init()
+	legacySet.set(legacyLabelOwner, legacyOwnerK8SKV)
+	if app != "" {
+		legacySet.set(legacyLabelApp, app)
+	}
+
+	var buckets []BucketInfo
+	seen := make(map[string]bool)
+	for _, set := range []labels{set, legacySet} {
+		cfgMaps, err := implementer.List(meta_v1.ListOptions{
+			LabelSelector: k8slabels.SelectorFromSet(k8slabels.Set(set.toMap())).String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cfgMap := range cfgMaps.Items {
+			var lbs labels
+			lbs.init()
+			lbs.fromMap(cfgMap.Labels)
+			if !lbs.match(set) || seen[cfgMap.Name] {
+				continue
+			}
+			seen[cfgMap.Name] = true
+
+			im, err := decodeConfigMap(serializer, &cfgMap)
+			if err != nil && !IsCorrupted(err) {
+				return nil, err
+			}
+
+			app := lbs.get(labelApp)
+			if _, ok := lbs[labelApp]; !ok {
+				app = lbs.get(legacyLabelApp)
+			}
+
+			buckets = append(buckets, BucketInfo{
+				Name:      cfgMap.Name,
+				App:       app,
+				Size:      len(cfgMap.Data[dataKey]),
+				Keys:      len(im),
+				Corrupted: err != nil,
+			})
+		}
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+
+	return buckets, nil
+}
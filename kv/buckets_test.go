@@ -0,0 +1,85 @@
+package kv
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestListBuckets(t *testing.T) {
+	encoded, err := encodeInternalMap(DefaultSerializer(), map[string][]byte{
+		"a": []byte("a-val"),
+		"b": []byte("b-val"),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode map: %s", err)
+	}
+
+	fi := &fakeImplementer{
+		listMaps: []v1.ConfigMap{
+			{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name:   "b2",
+					Labels: map[string]string{"BUCKET": "b2", "APP": "app", "OWNER": "K8S-KV"},
+				},
+				Data: map[string]string{dataKey: ""},
+			},
+			{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name:   "b1",
+					Labels: map[string]string{"BUCKET": "b1", "APP": "app", "OWNER": "K8S-KV"},
+				},
+				Data: map[string]string{dataKey: encoded},
+			},
+			{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name: "b3",
+					Labels: map[string]string{
+						"k8s-kv/bucket":                "b3",
+						"app.kubernetes.io/part-of":    "app",
+						"app.kubernetes.io/managed-by": "k8s-kv",
+						// created in compatibility mode
+						"BUCKET": "b3", "APP": "app", "OWNER": "K8S-KV",
+					},
+				},
+			},
+			{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name:   "other",
+					Labels: map[string]string{"BUCKET": "other", "APP": "other-app", "OWNER": "K8S-KV"},
+				},
+			},
+		},
+	}
+
+	buckets, err := ListBuckets(fi, "app")
+	if err != nil {
+		t.Fatalf("failed to list buckets: %s", err)
+	}
+
+	if fi.listOptions.LabelSelector != "APP=app,OWNER=K8S-KV" {
+		t.Errorf("unexpected label selector: %s", fi.listOptions.LabelSelector)
+	}
+
+	if len(buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got: %d", len(buckets))
+	}
+
+	if buckets[0].Name != "b1" || buckets[0].App != "app" {
+		t.Errorf("unexpected first bucket: %+v", buckets[0])
+	}
+	if buckets[0].Keys != 2 {
+		t.Errorf("expected 2 keys, got: %d", buckets[0].Keys)
+	}
+	if buckets[0].Size != len(encoded) {
+		t.Errorf("expected size %d, got: %d", len(encoded), buckets[0].Size)
+	}
+	if buckets[1].Name != "b2" || buckets[1].Keys != 0 {
+		t.Errorf("unexpected second bucket: %+v", buckets[1])
+	}
+	if buckets[2].Name != "b3" || buckets[2].App != "app" {
+		t.Errorf("unexpected third bucket: %+v", buckets[2])
+	}
+}
@@ -0,0 +1,125 @@
+package kv
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchRetryInterval is how long cache waits before re-establishing a failed watch
+const watchRetryInterval = 5 * time.Second
+
+// bucketCache keeps latest known version of bucket's config map, it's updated by
+// a background watcher and by successful writes. Stopped cache is always empty: nothing keeps it up
+// to date anymore.
+type bucketCache struct {
+	implementer ConfigMapInterface
+	bucket      string
+
+	mu      sync.RWMutex
+	cfgMap  *v1.ConfigMap
+	stopped bool
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+func newBucketCache(implementer ConfigMapInterface, bucket string) *bucketCache {
+	c := &bucketCache{
+		implementer: implementer,
+		bucket:      bucket,
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// get returns a copy of cached config map or nil if nothing is cached.
+func (c *bucketCache) get() *v1.ConfigMap {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cfgMap == nil {
+		return nil
+	}
+	return c.cfgMap.DeepCopy()
+}
+
+func (c *bucketCache) set(cfgMap *v1.ConfigMap) {
+	c.mu.Lock()
+	if !c.stopped {
+		c.cfgMap = cfgMap.DeepCopy()
+	}
+	c.mu.Unlock()
+}
+
+func (c *bucketCache) invalidate() {
+	c.mu.Lock()
+	c.cfgMap = nil
+	c.mu.Unlock()
+}
+
+func (c *bucketCache) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+	<-c.doneCh
+
+	c.mu.Lock()
+	c.stopped = true
+	c.cfgMap = nil
+	c.mu.Unlock()
+}
+
+func (c *bucketCache) run() {
+	defer close(c.doneCh)
+
+	for {
+		w, err := c.implementer.Watch(meta_v1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", c.bucket).String(),
+		})
+		if err == nil {
+			c.consume(w)
+		}
+
+		// events might have been missed, next read has to go to API server
+		c.invalidate()
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// consume applies watch events to the cache until watch is closed or cache is stopped.
+func (c *bucketCache) consume(w watch.Interface) {
+	defer w.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if cfgMap, ok := event.Object.(*v1.ConfigMap); ok {
+					c.set(cfgMap)
+				}
+			case watch.Deleted:
+				c.invalidate()
+			case watch.Error:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package kv
+
+import (
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Copy creates dst bucket with all entries of src bucket. Labels, annotations and owner references of
+// src are copied as well, with bucket label pointing to dst. ErrBucketNotFound is returned if src doesn't
+// exist and ErrBucketExists if dst does.
+func (db *DB) Copy(src, dst string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.cfg.readOnly {
+		return ErrReadOnly
+	}
+
+	_, _, err := db.copyBucket(src, dst)
+	return err
+}
+
+// Rename moves all entries of old bucket to a new bucket and deletes the old one, same as Copy
+// followed by DeleteBucket. Handles of old bucket shouldn't be used after Rename. If old bucket is
+// written to while it's being renamed, the new bucket is removed again and conflict error is returned,
+// Rename can be retried.
+func (db *DB) Rename(old, new string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.cfg.readOnly {
+		return ErrReadOnly
+	}
+
+	srcMap, dstMap, err := db.copyBucket(old, new)
+	if err != nil {
+		return err
+	}
+
+	kv, err := db.detach(old)
+	if err == nil {
+		defer kv.Close()
+
+		kv.mu.Lock()
+		// deleting exactly the version that was copied, writes made in the meantime would be lost otherwise
+		err = kv.teardown(srcMap)
+		kv.mu.Unlock()
+	}
+	if err != nil {
+		// old bucket is still there, the copy may be missing its latest writes
+		db.implementer.Delete(new, &meta_v1.DeleteOptions{
+			Preconditions: &meta_v1.Preconditions{UID: &dstMap.UID},
+		})
+		return err
+	}
+	kv.audit(OpTeardown, "", nil)
+	return nil
+}
+
+// Merge copies entries of src bucket into dst bucket (dst is created if it doesn't exist, unless DB is
+// strict). Policy decides what happens to keys that exist in both buckets: SourceWins overwrites them
+// with src values, SkipConflicts keeps dst values. Merged values are checked by dst's validators, nothing
+// is written if any of them is rejected.
+func (db *DB) Merge(src, dst string, policy ConflictPolicy) (err error) {
+	data, _, err := db.readBucket(src)
+	if err != nil {
+		return err
+	}
+
+	kv, err := db.Bucket(dst)
+	if err != nil {
+		return err
+	}
+
+	ctx, end := kv.start(OpMerge)
+	defer end(&err)
+
+	kv.mu.Lock()
+	err = kv.update(ctx, func(im map[string][]byte) error {
+		for key, value := range data {
+			if _, ok := im[key]; ok && policy == SkipConflicts {
+				continue
+			}
+			if err := kv.validate(key, value); err != nil {
+				return err
+			}
+			im[key] = value
+		}
+		return nil
+	})
+	kv.mu.Unlock()
+
+	if err == nil {
+		kv.audit(OpMerge, src, nil)
+	}
+	return err
+}
+
+// readBucket reads and decodes bucket's config map without creating it.
+func (db *DB) readBucket(name string) (map[string][]byte, *v1.ConfigMap, error) {
+	cfgMap, err := db.implementer.Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil, ErrBucketNotFound
+		}
+		return nil, nil, err
+	}
+
+	im, err := decodeConfigMap(db.cfg.serializer, cfgMap)
+	if cerr, ok := err.(*CorruptedError); ok {
+		cerr.Bucket = name
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return im, cfgMap, nil
+}
+
+// copyBucket creates dst config map with data and metadata of src, it returns src and created dst config
+// maps. db.mu has to be held.
+func (db *DB) copyBucket(src, dst string) (*v1.ConfigMap, *v1.ConfigMap, error) {
+	im, srcMap, err := db.readBucket(src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// data is re-encoded so the copy is in the latest format
+	encoded, err := encodeInternalMap(db.cfg.serializer, im)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(encoded) > MaxBucketSize {
+		return nil, nil, ErrBucketTooLarge
+	}
+
+	var lbs labels
+	lbs.init()
+	lbs.fromMap(srcMap.Labels)
+	for _, key := range []string{labelBucket, legacyLabelBucket} {
+		if _, ok := lbs[key]; ok {
+			lbs.set(key, dst)
+		}
+	}
+
+	var annotations map[string]string
+	if len(srcMap.Annotations) > 0 {
+		annotations = make(map[string]string, len(srcMap.Annotations))
+		for key, val := range srcMap.Annotations {
+			annotations[key] = val
+		}
+	}
+
+	cfgMap := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            dst,
+			Labels:          lbs.toMap(),
+			Annotations:     annotations,
+			OwnerReferences: srcMap.OwnerReferences,
+		},
+		Data: map[string]string{
+			dataKey: encoded,
+		},
+	}
+
+	created, err := db.implementer.Create(cfgMap)
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil, nil, ErrBucketExists
+		}
+		return nil, nil, err
+	}
+	return srcMap, created, nil
+}
@@ -0,0 +1,162 @@
+package kv
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCopyRename(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	db, err := Open(impl, "app", WithLabels(map[string]string{"team": "infra"}))
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+
+	b1, _ := db.Bucket("b1")
+	b1.Put("foo", []byte("bar"))
+
+	if err := db.Copy("b1", "b2"); err != nil {
+		t.Fatalf("failed to copy: %s", err)
+	}
+	if err := db.Copy("b1", "b2"); err != ErrBucketExists {
+		t.Errorf("expected bucket exists error, got: %v", err)
+	}
+	if err := db.Copy("missing", "b3"); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+
+	if err := db.Rename("b2", "b3"); err != nil {
+		t.Fatalf("failed to rename: %s", err)
+	}
+	if _, err := impl.Get("b2", meta_v1.GetOptions{}); err == nil {
+		t.Errorf("expected old bucket to be deleted")
+	}
+
+	cfgMap, err := impl.Get("b3", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get renamed bucket: %s", err)
+	}
+	if cfgMap.Labels[labelBucket] != "b3" || cfgMap.Labels[labelApp] != "app" || cfgMap.Labels["team"] != "infra" {
+		t.Errorf("unexpected labels: %v", cfgMap.Labels)
+	}
+
+	b3, _ := db.Bucket("b3")
+	val, err := b3.Get("foo")
+	if err != nil || string(val) != "bar" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	db, _ := Open(impl, "app")
+	defer db.Close()
+
+	src, _ := db.Bucket("src")
+	src.PutMany(map[string][]byte{"a": []byte("src-a"), "b": []byte("src-b")})
+	dst, _ := db.Bucket("dst")
+	dst.PutMany(map[string][]byte{"a": []byte("dst-a"), "c": []byte("dst-c")})
+
+	if err := db.Merge("src", "dst", SkipConflicts); err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	data, _ := dst.List("")
+	if len(data) != 3 || string(data["a"]) != "dst-a" || string(data["b"]) != "src-b" {
+		t.Errorf("unexpected merged data: %v", data)
+	}
+
+	if err := db.Merge("src", "dst", SourceWins); err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	data, _ = dst.List("")
+	if string(data["a"]) != "src-a" {
+		t.Errorf("unexpected merged data: %v", data)
+	}
+
+	// incompressible data, each bucket fits but merged one doesn't
+	big := make([]byte, 600*1024)
+	rand.Read(big)
+	src.Put("big1", big)
+	rand.Read(big)
+	dst.Put("big2", big)
+
+	if err := db.Merge("src", "dst", SourceWins); err != ErrBucketTooLarge {
+		t.Errorf("expected bucket too large error, got: %v", err)
+	}
+}
+
+// conflictingDeletes fails deletes of the named config map as if it was modified in the meantime
+type conflictingDeletes struct {
+	ConfigMapInterface
+	name string
+}
+
+func (c *conflictingDeletes) Delete(name string, options *meta_v1.DeleteOptions) error {
+	if name == c.name {
+		return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, name, fmt.Errorf("modified"))
+	}
+	return c.ConfigMapInterface.Delete(name, options)
+}
+
+func TestRenameFailure(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	recorder := &fakeRecorder{}
+	db, _ := Open(&conflictingDeletes{ConfigMapInterface: impl, name: "b1"}, "app", WithEventRecorder(recorder))
+	defer db.Close()
+
+	b1, _ := db.Bucket("b1")
+	b1.Put("foo", []byte("bar"))
+
+	err := db.Rename("b1", "b2")
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected conflict error, got: %v", err)
+	}
+	if _, err := impl.Get("b1", meta_v1.GetOptions{}); err != nil {
+		t.Errorf("expected old bucket to be kept, got: %v", err)
+	}
+	if _, err := impl.Get("b2", meta_v1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected new bucket to be removed, got: %v", err)
+	}
+
+	b2, _ := db.Bucket("b2")
+	b2.Put("foo", []byte("bar"))
+	recorder.events = nil
+
+	if err := db.Rename("b2", "b3"); err != nil {
+		t.Fatalf("failed to rename: %s", err)
+	}
+	if len(recorder.events) != 1 || recorder.events[0] != "default/b2 Normal BucketDeleted" {
+		t.Errorf("unexpected events: %v", recorder.events)
+	}
+}
+
+func TestMergeValidators(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	src, _ := New(impl, "app", "src")
+	src.PutMany(map[string][]byte{"a": []byte("valid"), "b": []byte("invalid")})
+
+	db, _ := Open(impl, "app", WithValidator("", func(key string, value []byte) error {
+		if string(value) == "invalid" {
+			return fmt.Errorf("rejected")
+		}
+		return nil
+	}))
+	defer db.Close()
+
+	err := db.Merge("src", "dst", SourceWins)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+	dst, _ := db.Bucket("dst")
+	data, _ := dst.List("")
+	if len(data) != 0 {
+		t.Errorf("expected nothing to be merged, got: %v", data)
+	}
+}
@@ -0,0 +1,92 @@
+package kv
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Incr atomically adds delta to the counter stored under key and returns its new value. Counters are
+// stored as decimal strings, missing key is treated as 0. Update is retried if bucket was modified
+// concurrently so increments from multiple nodes are not lost.
+func (k *KV) Incr(key string, delta int64) (value int64, err error) {
+	ctx, end := k.start(OpIncr)
+	defer end(&err)
+
+	k.mu.Lock()
+	err = k.update(ctx, func(im map[string][]byte) error {
+		current, err := parseCounter(key, im[key])
+		if err != nil {
+			return err
+		}
+		value = current + delta
+		encoded := []byte(strconv.FormatInt(value, 10))
+		if err := k.validate(key, encoded); err != nil {
+			return err
+		}
+		im[key] = encoded
+		return nil
+	})
+	k.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	k.audit(OpIncr, key, []byte(strconv.FormatInt(value, 10)))
+	return value, nil
+}
+
+func parseCounter(key string, data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of key '%s' is not a counter: %s", key, err)
+	}
+	return value, nil
+}
+
+// Sequence hands out unique, increasing IDs backed by a counter key. To save API calls IDs are reserved
+// in ranges of bandwidth size with a single write, IDs reserved but not used before process exits are lost
+// so sequences can have gaps.
+type Sequence struct {
+	kv        *KV
+	key       string
+	bandwidth int64
+
+	mu     sync.Mutex
+	next   int64
+	leased int64
+}
+
+// NewSequence creates a sequence stored under key, bandwidth is how many IDs are reserved at once.
+func NewSequence(kv *KV, key string, bandwidth int64) *Sequence {
+	if bandwidth < 1 {
+		bandwidth = 1
+	}
+	return &Sequence{
+		kv:        kv,
+		key:       key,
+		bandwidth: bandwidth,
+	}
+}
+
+// Next returns next ID of the sequence, first ID of a new sequence is 1.
+func (s *Sequence) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == 0 || s.next > s.leased {
+		leased, err := s.kv.Incr(s.key, s.bandwidth)
+		if err != nil {
+			return 0, err
+		}
+		s.leased = leased
+		s.next = leased - s.bandwidth + 1
+	}
+
+	id := s.next
+	s.next++
+	return id, nil
+}
@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func newCounterTestKV(t *testing.T) (*KV, *fakeImplementer) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "counters")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	return kv, fi
+}
+
+func TestIncr(t *testing.T) {
+	kv, _ := newCounterTestKV(t)
+
+	val, err := kv.Incr("builds", 1)
+	if err != nil {
+		t.Fatalf("failed to incr: %s", err)
+	}
+	if val != 1 {
+		t.Errorf("expected 1, got: %d", val)
+	}
+
+	val, err = kv.Incr("builds", 10)
+	if err != nil {
+		t.Fatalf("failed to incr: %s", err)
+	}
+	if val != 11 {
+		t.Errorf("expected 11, got: %d", val)
+	}
+
+	stored, err := kv.Get("builds")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if string(stored) != "11" {
+		t.Errorf("expected '11' to be stored, got: %s", string(stored))
+	}
+
+	kv.Put("name", []byte("not a number"))
+	_, err = kv.Incr("name", 1)
+	if err == nil {
+		t.Errorf("expected error when incrementing non-counter value")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	kv, fi := newCounterTestKV(t)
+
+	seq := NewSequence(kv, "invoices", 10)
+
+	gets := fi.getCount
+	for i := int64(1); i <= 25; i++ {
+		id, err := seq.Next()
+		if err != nil {
+			t.Fatalf("failed to get next id: %s", err)
+		}
+		if id != i {
+			t.Fatalf("expected id %d, got: %d", i, id)
+		}
+	}
+
+	// 3 ranges reserved
+	if fi.getCount-gets != 3 {
+		t.Errorf("expected 3 reservations, got: %d", fi.getCount-gets)
+	}
+
+	// another sequence on the same key continues after reserved range
+	other := NewSequence(kv, "invoices", 10)
+	id, err := other.Next()
+	if err != nil {
+		t.Fatalf("failed to get next id: %s", err)
+	}
+	if id != 31 {
+		t.Errorf("expected id 31, got: %d", id)
+	}
+}
@@ -0,0 +1,236 @@
+package kv
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when DB is used after Close()
+var ErrClosed = errors.New("db is closed")
+
+// ErrSingleNamespace is returned when DB opened with Open is asked for a bucket in another namespace
+var ErrSingleNamespace = errors.New("db is bound to a single namespace, use Namespaced to access other namespaces")
+
+// ConfigMapsGetter returns config maps of any namespace, it's a subset of client-go's CoreV1Interface.
+type ConfigMapsGetter interface {
+	ConfigMaps(namespace string) ConfigMapInterface
+}
+
+// ConfigMapsGetterFunc adapts a function to ConfigMapsGetter, use it to wrap client-go's clientset:
+//
+//	getter := kv.ConfigMapsGetterFunc(func(namespace string) kv.ConfigMapInterface {
+//		return client.CoreV1().ConfigMaps(namespace)
+//	})
+type ConfigMapsGetterFunc func(namespace string) ConfigMapInterface
+
+// ConfigMaps implements ConfigMapsGetter.
+func (f ConfigMapsGetterFunc) ConfigMaps(namespace string) ConfigMapInterface {
+	return f(namespace)
+}
+
+// DB manages multiple buckets of the same app. Bucket handles returned by DB share
+// serializer, cache and retry settings.
+type DB struct {
+	implementer ConfigMapInterface
+	// getter is set for DBs created with Namespaced
+	getter    ConfigMapsGetter
+	namespace string
+	app       string
+	cfg       config
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*KV
+	closed  bool
+}
+
+type bucketKey struct {
+	namespace string
+	name      string
+}
+
+// Open creates a new DB for the app. Buckets are created lazily when they are first requested.
+func Open(implementer ConfigMapInterface, app string, opts ...Option) (*DB, error) {
+	if implementer == nil {
+		return nil, errors.New("config map implementer is required")
+	}
+
+	cfg := newConfig(opts)
+	return &DB{
+		implementer: implementer,
+		app:         app,
+		cfg:         cfg,
+		buckets:     make(map[bucketKey]*KV),
+	}, nil
+}
+
+// Namespaced creates a new DB for the app that can open buckets in any namespace (or cluster, getter decides
+// where config maps come from). Bucket and other DB methods work with the given namespace, BucketIn
+// opens buckets in other namespaces.
+func Namespaced(getter ConfigMapsGetter, namespace, app string, opts ...Option) (*DB, error) {
+	if getter == nil {
+		return nil, errors.New("config maps getter is required")
+	}
+
+	return &DB{
+		implementer: getter.ConfigMaps(namespace),
+		getter:      getter,
+		namespace:   namespace,
+		app:         app,
+		cfg:         newConfig(opts),
+		buckets:     make(map[bucketKey]*KV),
+	}, nil
+}
+
+// Bucket returns a handle to the named bucket, creating bucket's config map if it doesn't exist (unless
+// DB is read-only or strict). Handles are reused so calling Bucket multiple times with the same name is cheap.
+func (db *DB) Bucket(name string) (*KV, error) {
+	return db.BucketIn(db.namespace, name)
+}
+
+// BucketIn returns a handle to the named bucket in the namespace, same as Bucket. DBs created with Open
+// don't know the namespace of their config map interface, they return ErrSingleNamespace for any
+// namespace other than an empty one.
+func (db *DB) BucketIn(namespace, name string) (*KV, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	key := bucketKey{namespace: namespace, name: name}
+	if kv, ok := db.buckets[key]; ok {
+		return kv, nil
+	}
+
+	implementer, err := db.implementerFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := newKV(implementer, db.app, name, db.configFor(namespace))
+	if err != nil {
+		return nil, err
+	}
+	db.buckets[key] = kv
+
+	return kv, nil
+}
+
+func (db *DB) implementerFor(namespace string) (ConfigMapInterface, error) {
+	if namespace == db.namespace {
+		return db.implementer, nil
+	}
+	if db.getter == nil {
+		return nil, ErrSingleNamespace
+	}
+	return db.getter.ConfigMaps(namespace), nil
+}
+
+// configFor returns config of buckets in the namespace. Owner references can't point to other namespaces
+// (garbage collector would delete such buckets) so buckets in other namespaces are created without owners.
+func (db *DB) configFor(namespace string) config {
+	cfg := db.cfg
+	if namespace != db.namespace {
+		cfg.owners = nil
+	}
+	return cfg
+}
+
+// CreateBucket creates the named bucket and returns a handle to it, ErrBucketExists is returned if bucket
+// already exists.
+func (db *DB) CreateBucket(name string) (*KV, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	key := bucketKey{namespace: db.namespace, name: name}
+	if kv, ok := db.buckets[key]; ok {
+		// handle may already be in use, ie: it was returned by Bucket of a strict DB before bucket existed
+		if db.cfg.readOnly {
+			return nil, ErrReadOnly
+		}
+		if err := kv.create(); err != nil {
+			return nil, err
+		}
+		return kv, nil
+	}
+
+	kv, err := createBucket(db.implementer, db.app, name, db.configFor(db.namespace))
+	if err != nil {
+		return nil, err
+	}
+	db.buckets[key] = kv
+
+	return kv, nil
+}
+
+// Buckets lists all buckets that belong to DB's app.
+func (db *DB) Buckets() ([]BucketInfo, error) {
+	return listBuckets(db.implementer, db.app, db.cfg.serializer)
+}
+
+// BucketsIn lists all buckets that belong to DB's app in the namespace.
+func (db *DB) BucketsIn(namespace string) ([]BucketInfo, error) {
+	implementer, err := db.implementerFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return listBuckets(implementer, db.app, db.cfg.serializer)
+}
+
+// DeleteBucket removes bucket and all of its data, same as Teardown of bucket's handle.
+func (db *DB) DeleteBucket(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.cfg.readOnly {
+		return ErrReadOnly
+	}
+
+	kv, err := db.detach(name)
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+
+	return kv.Teardown()
+}
+
+// detach removes bucket's handle from DB and returns it so bucket can be deleted, caller has to close it.
+// Bucket isn't created if it doesn't exist. db.mu has to be held.
+func (db *DB) detach(name string) (*KV, error) {
+	key := bucketKey{namespace: db.namespace, name: name}
+	if kv, ok := db.buckets[key]; ok {
+		delete(db.buckets, key)
+		return kv, nil
+	}
+
+	// handle of a missing bucket shouldn't create it
+	cfg := db.configFor(db.namespace)
+	cfg.strict = true
+	return newKV(db.implementer, db.app, name, cfg)
+}
+
+// Close stops background watchers of all opened buckets. Bucket handles shouldn't be used after DB is closed.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	for key, kv := range db.buckets {
+		kv.Close()
+		delete(db.buckets, key)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package kv
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDBBucket(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+
+	db, err := Open(fi, "app", WithConflictRetries(1))
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+
+	b1, err := db.Bucket("b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+
+	again, err := db.Bucket("b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+
+	if b1 != again {
+		t.Errorf("expected the same bucket handle")
+	}
+
+	if b1.conflictRetries != 1 {
+		t.Errorf("expected bucket to inherit conflict retries, got: %d", b1.conflictRetries)
+	}
+
+	err = db.DeleteBucket("b1")
+	if err != nil {
+		t.Fatalf("failed to delete bucket: %s", err)
+	}
+
+	if fi.deletedName != "b1" {
+		t.Errorf("expected b1 to be deleted, got: %s", fi.deletedName)
+	}
+
+	db.Close()
+
+	_, err = db.Bucket("b2")
+	if err != ErrClosed {
+		t.Errorf("expected ErrClosed, got: %v", err)
+	}
+}
+
+func TestDBCache(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "b1"},
+			Data:       map[string]string{},
+		},
+	}
+	fi.Watch(meta_v1.ListOptions{})
+
+	db, err := Open(fi, "app", WithCache())
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+
+	b1, err := db.Bucket("b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+
+	encoded, err := encodeInternalMap(DefaultSerializer(), map[string][]byte{"foo": []byte("bar")})
+	if err != nil {
+		t.Fatalf("failed to encode map: %s", err)
+	}
+
+	// config map updated by another replica
+	fi.watcher.Modify(&v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "b1"},
+		Data:       map[string]string{dataKey: encoded},
+	})
+
+	gets := fi.getCount
+	deadline := time.Now().Add(time.Second)
+	for {
+		val, err := b1.Get("foo")
+		if err == nil {
+			if string(val) != "bar" {
+				t.Errorf("expected 'bar' but got: %s", string(val))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cache wasn't updated by watcher: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if fi.getCount != gets {
+		t.Errorf("expected reads to be served from cache, got %d API gets", fi.getCount-gets)
+	}
+}
+
+func TestClosedCache(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	kv, err := New(impl, "app", "b1", WithCache())
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	kv.Put("foo", []byte("v1"))
+	kv.Close()
+	kv.Get("foo")
+
+	// written by another client, closed handle doesn't see watch events anymore
+	other, _ := New(impl, "app", "b1")
+	other.Put("foo", []byte("v2"))
+
+	if val, err := kv.Get("foo"); err != nil || string(val) != "v2" {
+		t.Errorf("expected closed handle to read from API server, got: %s, %v", val, err)
+	}
+}
+
+func TestDBCreateBucket(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	db, _ := Open(impl, "app", WithStrict(), WithCache())
+	defer db.Close()
+
+	b1, err := db.Bucket("b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+	created, err := db.CreateBucket("b1")
+	if err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+	if created != b1 {
+		t.Errorf("expected existing handle to be reused")
+	}
+	if _, err := db.CreateBucket("b1"); err != ErrBucketExists {
+		t.Errorf("expected bucket exists error, got: %v", err)
+	}
+
+	// handle keeps its watcher
+	select {
+	case <-b1.cache.doneCh:
+		t.Errorf("handle returned by Bucket was closed")
+	default:
+	}
+}
@@ -0,0 +1,135 @@
+package kv
+
+import (
+	"sort"
+	"strings"
+)
+
+// PathSeparator separates directories in hierarchical keys such as "/somedir/key-here"
+const PathSeparator = "/"
+
+// DirEntry is an immediate child of a directory returned by ListDir.
+type DirEntry struct {
+	// Name of the entry relative to listed directory
+	Name string
+	// Key is the full key (or directory prefix when IsDir is true)
+	Key   string
+	IsDir bool
+}
+
+// ListDir returns immediate children of the directory: keys stored directly in it and its sub-directories.
+// Directories are implicit, they exist as long as there are keys under them. Entries are sorted by name.
+func (k *KV) ListDir(path string) (entries []DirEntry, err error) {
+	ctx, end := k.start(OpListDir)
+	defer end(&err)
+
+	im, err := k.readInternalMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return listDir(im, dirPrefix(path)), nil
+}
+
+// DeleteTree removes all entries of the directory (and its sub-directories) using a single config map update.
+// Path is a directory, "tenant1" and "tenant1/" both delete "tenant1/..." keys but not "tenant10/...".
+func (k *KV) DeleteTree(path string) (err error) {
+	ctx, end := k.start(OpDeleteTree)
+	defer end(&err)
+
+	prefix := dirPrefix(path)
+
+	k.mu.Lock()
+	err = k.update(ctx, func(im map[string][]byte) error {
+		for key := range im {
+			if strings.HasPrefix(key, prefix) {
+				delete(im, key)
+			}
+		}
+		return nil
+	})
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpDeleteTree, prefix, nil)
+	}
+	return err
+}
+
+// Sub returns KVDB scoped to the directory, keys passed to it are stored with directory prefix ("path/")
+// prepended and List returns keys with the prefix trimmed. Teardown of a sub store only removes entries
+// of the directory.
+func (k *KV) Sub(path string) KVDB {
+	return &subKV{kv: k, prefix: dirPrefix(path)}
+}
+
+// dirPrefix turns directory path into a key prefix, root directory is an empty path.
+func dirPrefix(path string) string {
+	if path == "" || strings.HasSuffix(path, PathSeparator) {
+		return path
+	}
+	return path + PathSeparator
+}
+
+func listDir(im map[string][]byte, prefix string) []DirEntry {
+	seen := make(map[string]bool)
+	var entries []DirEntry
+	for key := range im {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := key[len(prefix):]
+
+		entry := DirEntry{Name: rest, Key: key}
+		if i := strings.Index(rest, PathSeparator); i >= 0 {
+			entry = DirEntry{
+				Name:  rest[:i],
+				Key:   prefix + rest[:i+1],
+				IsDir: true,
+			}
+		}
+
+		if seen[entry.Key] {
+			continue
+		}
+		seen[entry.Key] = true
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+type subKV struct {
+	kv     *KV
+	prefix string
+}
+
+func (s *subKV) Put(key string, value []byte) error {
+	return s.kv.Put(s.prefix+key, value)
+}
+
+func (s *subKV) Get(key string) (value []byte, err error) {
+	return s.kv.Get(s.prefix + key)
+}
+
+func (s *subKV) Delete(key string) error {
+	return s.kv.Delete(s.prefix + key)
+}
+
+func (s *subKV) List(prefix string) (data map[string][]byte, err error) {
+	items, err := s.kv.List(s.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	data = make(map[string][]byte, len(items))
+	for key, val := range items {
+		data[strings.TrimPrefix(key, s.prefix)] = val
+	}
+	return data, nil
+}
+
+func (s *subKV) Teardown() error {
+	return s.kv.DeleteTree(s.prefix)
+}
@@ -0,0 +1,180 @@
+package kv
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func newDirTestKV(t *testing.T) *KV {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	err = kv.PutMany(map[string][]byte{
+		"/somedir/key-here":       []byte("1"),
+		"/somedir/other":          []byte("2"),
+		"/somedir/nested/key":     []byte("3"),
+		"/somedir/nested/deep/ko": []byte("4"),
+		"/otherdir/key":           []byte("5"),
+		"top":                     []byte("6"),
+	})
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	return kv
+}
+
+func TestListDir(t *testing.T) {
+	kv := newDirTestKV(t)
+
+	entries, err := kv.ListDir("/somedir")
+	if err != nil {
+		t.Fatalf("failed to list dir: %s", err)
+	}
+
+	expected := []DirEntry{
+		{Name: "key-here", Key: "/somedir/key-here"},
+		{Name: "nested", Key: "/somedir/nested/", IsDir: true},
+		{Name: "other", Key: "/somedir/other"},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got: %+v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("expected %+v, got: %+v", expected[i], entries[i])
+		}
+	}
+
+	root, err := kv.ListDir("/")
+	if err != nil {
+		t.Fatalf("failed to list dir: %s", err)
+	}
+	if len(root) != 2 || root[0].Name != "otherdir" || root[1].Name != "somedir" {
+		t.Errorf("unexpected root entries: %+v", root)
+	}
+}
+
+func TestDeleteTree(t *testing.T) {
+	kv := newDirTestKV(t)
+
+	err := kv.DeleteTree("/somedir/")
+	if err != nil {
+		t.Fatalf("failed to delete tree: %s", err)
+	}
+
+	items, err := kv.List("")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("expected 2 items left, got: %d", len(items))
+	}
+	if _, ok := items["/otherdir/key"]; !ok {
+		t.Errorf("expected '/otherdir/key' to be kept")
+	}
+}
+
+func TestSub(t *testing.T) {
+	kv := newDirTestKV(t)
+
+	sub := kv.Sub("/somedir/nested/")
+
+	val, err := sub.Get("key")
+	if err != nil {
+		t.Fatalf("failed to get key: %s", err)
+	}
+	if string(val) != "3" {
+		t.Errorf("expected '3' but got: %s", string(val))
+	}
+
+	err = sub.Put("new", []byte("7"))
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	val, err = kv.Get("/somedir/nested/new")
+	if err != nil {
+		t.Fatalf("failed to get key: %s", err)
+	}
+	if string(val) != "7" {
+		t.Errorf("expected '7' but got: %s", string(val))
+	}
+
+	items, err := sub.List("")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(items) != 3 || string(items["deep/ko"]) != "4" {
+		t.Errorf("unexpected sub items: %v", items)
+	}
+
+	err = sub.Teardown()
+	if err != nil {
+		t.Fatalf("failed to teardown sub: %s", err)
+	}
+
+	all, _ := kv.List("")
+	if len(all) != 4 {
+		t.Errorf("expected 4 items left, got: %d", len(all))
+	}
+}
+
+func TestDirSiblingPrefixes(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	err = kv.PutMany(map[string][]byte{
+		"tenant1/x":  []byte("1"),
+		"tenant10/y": []byte("2"),
+		"tenant2/z":  []byte("3"),
+	})
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	sub := kv.Sub("tenant1")
+	items, err := sub.List("")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(items) != 1 || string(items["x"]) != "1" {
+		t.Errorf("unexpected sub items: %v", items)
+	}
+
+	err = sub.Teardown()
+	if err != nil {
+		t.Fatalf("failed to teardown sub: %s", err)
+	}
+
+	all, _ := kv.List("")
+	if len(all) != 2 || all["tenant10/y"] == nil || all["tenant2/z"] == nil {
+		t.Errorf("expected sibling directories to be kept, got: %v", all)
+	}
+
+	err = kv.DeleteTree("tenant2")
+	if err != nil {
+		t.Fatalf("failed to delete tree: %s", err)
+	}
+
+	all, _ = kv.List("")
+	if len(all) != 1 || all["tenant10/y"] == nil {
+		t.Errorf("expected only 'tenant10/y' to be kept, got: %v", all)
+	}
+}
@@ -6,11 +6,12 @@ node application.
 Basics
 There are only few things worth to know: key/value database is created based on bucket name so in order
 to have multiple configMaps - use different bucket names. Teardown() function will remove configMap entry
-completely destroying all entries.
+completely destroying all entries (unless soft delete is enabled, see WithSoftDelete and Undelete).
 Caveats
 Since k8s-kv is based on configMaps which are in turn based on Etcd key/value store - all values have a limitation
 of 1MB so each bucket in k8s-kv is limited to that size. To overcome it - create more buckets.
 If you have multi-node application that is frequently reading/writing to the same buckets - be aware of race
-conditions as it doesn't provide any cross-node locking capabilities.
+conditions, operations are not locked across nodes. Writes are retried on conflicting updates and Locker can be used
+to get a cross-node lock stored in a bucket when a sequence of operations has to be exclusive.
 */
 package kv
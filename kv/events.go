@@ -0,0 +1,73 @@
+package kv
+
+import (
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MaxBucketSize is the maximum size of bucket data, config maps are limited to 1MB by Etcd.
+const MaxBucketSize = 1024 * 1024
+
+// sizeWarningRatio is the share of MaxBucketSize after which size warning events are emitted
+const sizeWarningRatio = 0.9
+
+// event reasons
+const (
+	ReasonBucketCreated      = "BucketCreated"
+	ReasonBucketDeleted      = "BucketDeleted"
+	ReasonBucketSizeWarning  = "BucketSizeWarning"
+	ReasonBucketDecodeFailed = "BucketDecodeFailed"
+	ReasonBucketConflicts    = "BucketConflicts"
+	ReasonBucketRepaired     = "BucketRepaired"
+	ReasonBucketUndeleted    = "BucketUndeleted"
+	ReasonAuditFailed        = "AuditFailed"
+)
+
+// EventRecorder implements a subset of client-go's record.EventRecorder.
+type EventRecorder interface {
+	Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// WithEventRecorder emits Kubernetes Events on bucket's config map when bucket is created or deleted, when
+// its size gets close to the limit, when its data can't be decoded and when writes keep conflicting.
+func WithEventRecorder(recorder EventRecorder) Option {
+	return func(c *config) {
+		c.eventRecorder = recorder
+	}
+}
+
+// event emits event about bucket's config map (if event recorder is set). Config map has to be the one
+// that was read or written, kubectl describe only shows events that reference its UID.
+func (k *KV) event(cfgMap *v1.ConfigMap, eventtype, reason, messageFmt string, args ...interface{}) {
+	if k.eventRecorder == nil {
+		return
+	}
+	k.eventRecorder.Eventf(bucketObjectRef(cfgMap), eventtype, reason, messageFmt, args...)
+}
+
+// checkSize emits warning event if encoded bucket data is close to the size limit.
+func (k *KV) checkSize(cfgMap *v1.ConfigMap, encoded string) {
+	if float64(len(encoded)) < MaxBucketSize*sizeWarningRatio {
+		return
+	}
+	k.event(cfgMap, v1.EventTypeWarning, ReasonBucketSizeWarning, "bucket data is %d bytes, %.1f%% of %d bytes limit",
+		len(encoded), float64(len(encoded))/MaxBucketSize*100, MaxBucketSize)
+}
+
+// bucketObjectRef returns config map object that events about the bucket are attached to, it only has
+// the metadata event recorders use to reference it.
+func bucketObjectRef(cfgMap *v1.ConfigMap) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta: meta_v1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            cfgMap.Name,
+			Namespace:       cfgMap.Namespace,
+			UID:             cfgMap.UID,
+			ResourceVersion: cfgMap.ResourceVersion,
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeAPIServer does what fake clientset doesn't: it assigns UIDs and resource versions to config maps and
+// checks UID preconditions of deletes. Next conflicts updates fail with conflict errors.
+type fakeAPIServer struct {
+	ConfigMapInterface
+	uids      int
+	versions  int
+	conflicts int
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	return &fakeAPIServer{ConfigMapInterface: fake.NewSimpleClientset().CoreV1().ConfigMaps("default")}
+}
+
+func (s *fakeAPIServer) Create(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	cfgMap = cfgMap.DeepCopy()
+	s.uids++
+	s.versions++
+	cfgMap.UID = types.UID(fmt.Sprintf("uid-%d", s.uids))
+	cfgMap.ResourceVersion = fmt.Sprint(s.versions)
+	return s.ConfigMapInterface.Create(cfgMap)
+}
+
+func (s *fakeAPIServer) Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, cfgMap.Name, fmt.Errorf("modified"))
+	}
+	cfgMap = cfgMap.DeepCopy()
+	s.versions++
+	cfgMap.ResourceVersion = fmt.Sprint(s.versions)
+	return s.ConfigMapInterface.Update(cfgMap)
+}
+
+func (s *fakeAPIServer) Delete(name string, options *meta_v1.DeleteOptions) error {
+	if options != nil && options.Preconditions != nil && options.Preconditions.UID != nil {
+		current, err := s.ConfigMapInterface.Get(name, meta_v1.GetOptions{})
+		if err == nil && current.UID != *options.Preconditions.UID {
+			return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, name, fmt.Errorf("uid mismatch"))
+		}
+	}
+	return s.ConfigMapInterface.Delete(name, options)
+}
+
+func TestBucketEvents(t *testing.T) {
+	recorder := &fakeRecorder{}
+	impl := newFakeAPIServer()
+	kv, err := New(impl, "app", "b1", WithEventRecorder(recorder))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	impl.conflicts = 4
+	kv.Put("foo", []byte("bar"))
+
+	// incompressible data close to the size limit
+	big := make([]byte, 720*1024)
+	rand.Read(big)
+	if err := kv.Put("big", big); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	cfgMap, _ := impl.Get("b1", meta_v1.GetOptions{})
+	cfgMap.Data[dataKey] = "garbage"
+	impl.Update(cfgMap)
+	_, err = kv.Get("foo")
+	if err == nil {
+		t.Errorf("expected decode error")
+	}
+
+	kv.Teardown()
+
+	expected := []string{
+		"default/b1 Normal BucketCreated",
+		"default/b1 Warning BucketConflicts",
+		"default/b1 Warning BucketSizeWarning",
+		"default/b1 Warning BucketDecodeFailed",
+		"default/b1 Normal BucketDeleted",
+	}
+	if strings.Join(recorder.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected events: %v", recorder.events)
+	}
+	// kubectl describe matches events by UID
+	for i, uid := range recorder.uids {
+		if uid != "uid-1" {
+			t.Errorf("event %s references UID '%s'", recorder.events[i], uid)
+		}
+	}
+}
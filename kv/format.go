@@ -0,0 +1,216 @@
+package kv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Encoded bucket data (before base64) starts with a header:
+//
+//	magic "KKV" | format version | serializer id | codec id | payload checksum | payload
+//
+// Buckets written before the header was introduced (format version 0) are gzip compressed
+// output of the serializer without any header. Checksum is SHA-256 of the payload, it's part
+// of the same config map value so it can't go stale when someone else rewrites the data.
+var formatMagic = []byte("KKV")
+
+// format versions
+const (
+	formatLegacy = 0
+	formatV1     = 1
+	// formatVersion is the version new data is written in
+	formatVersion = formatV1
+)
+
+const headerLen = 6
+
+// serializer ids
+const (
+	// serializerCustom means data was written by a serializer set with WithSerializer,
+	// it's decoded with the configured serializer
+	serializerCustom byte = 0
+	serializerGob    byte = 1
+)
+
+// codec ids
+const (
+	codecNone byte = 0
+	codecGzip byte = 1
+)
+
+// ErrUnsupportedFormat is returned when bucket data was written in a format this version can't read,
+// ie: by a newer version of k8s-kv or with a different serializer (see WithSerializer).
+var ErrUnsupportedFormat = errors.New("unsupported bucket data format")
+
+type formatHeader struct {
+	version    byte
+	serializer byte
+	codec      byte
+	// checksum of the payload, missing in legacy data
+	checksum []byte
+}
+
+// parseHeader splits encoded bucket data into header and payload.
+func parseHeader(b []byte) (formatHeader, []byte) {
+	if len(b) < headerLen || !bytes.HasPrefix(b, formatMagic) {
+		return formatHeader{version: formatLegacy, serializer: serializerCustom, codec: codecGzip}, b
+	}
+	h := formatHeader{version: b[3], serializer: b[4], codec: b[5]}
+	payload := b[headerLen:]
+	// truncated data is left without checksum and fails verification
+	if h.version >= formatV1 && len(payload) >= sha256.Size {
+		h.checksum, payload = payload[:sha256.Size], payload[sha256.Size:]
+	}
+	return h, payload
+}
+
+func (h formatHeader) bytes() []byte {
+	b := append(append([]byte{}, formatMagic...), h.version, h.serializer, h.codec)
+	if h.version >= formatV1 {
+		b = append(b, h.checksum...)
+	}
+	return b
+}
+
+func payloadChecksum(payload []byte) []byte {
+	sum := sha256.Sum256(payload)
+	return sum[:]
+}
+
+func serializerID(serializer Serializer) byte {
+	if _, ok := serializer.(*GobSerializer); ok {
+		return serializerGob
+	}
+	return serializerCustom
+}
+
+// serializerFor returns serializer that wrote the data, configured serializer is used for custom ones.
+func serializerFor(id byte, configured Serializer) (Serializer, error) {
+	switch id {
+	case serializerCustom:
+		return configured, nil
+	case serializerGob:
+		return &GobSerializer{}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// decompress decompresses payload with the codec.
+func decompress(codec byte, payload []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return payload, nil
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, &CorruptedError{Stage: "gzip", Err: err}
+		}
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, &CorruptedError{Stage: "gzip", Err: err}
+		}
+		return decompressed, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// decoders of format versions, each one gets serializer configured for the bucket
+var decoders = map[byte]func(serializer Serializer, h formatHeader, payload []byte) (map[string][]byte, error){
+	formatLegacy: decodeLegacy,
+	formatV1:     decodeV1,
+}
+
+// decodeV1 verifies payload checksum and decodes it the same way as legacy data. Payload that passed the
+// checksum isn't corrupted, if it can't be decoded it was written with a different serializer.
+func decodeV1(serializer Serializer, h formatHeader, payload []byte) (map[string][]byte, error) {
+	if sum := payloadChecksum(payload); !bytes.Equal(sum, h.checksum) {
+		return nil, &CorruptedError{
+			Stage: "checksum",
+			Err:   fmt.Errorf("expected checksum %x, got %x", h.checksum, sum),
+		}
+	}
+
+	im, err := decodeLegacy(serializer, h, payload)
+	var cerr *CorruptedError
+	if errors.As(err, &cerr) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, cerr.Err)
+	}
+	return im, err
+}
+
+// decodeLegacy decodes payload without verifying it, legacy header is implied by parseHeader.
+func decodeLegacy(serializer Serializer, h formatHeader, payload []byte) (map[string][]byte, error) {
+	serializer, err := serializerFor(h.serializer, serializer)
+	if err != nil {
+		return nil, err
+	}
+
+	decompressed, err := decompress(h.codec, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var im internalMap
+	if err := serializer.Decode(decompressed, &im); err != nil {
+		return nil, &CorruptedError{Stage: "decode", Err: err}
+	}
+	return im.Data, nil
+}
+
+// dataFormat returns format version of base64 encoded bucket data.
+func dataFormat(data string) (int, error) {
+	if data == "" {
+		return formatVersion, nil
+	}
+	b, err := b64.DecodeString(data)
+	if err != nil {
+		return 0, &CorruptedError{Stage: "base64", Err: err}
+	}
+	h, _ := parseHeader(b)
+	return int(h.version), nil
+}
+
+// Migrate rewrites bucket data in the latest format and adds app.kubernetes.io/* labels to buckets
+// created by older versions (legacy labels are kept). Buckets written by older versions of k8s-kv are
+// still readable, migrating them makes every read skip the legacy decoders. Buckets already in the
+// latest format are left untouched.
+func (k *KV) Migrate() (err error) {
+	ctx, end := k.start(OpMigrate)
+	defer end(&err)
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	cfgMap, im, err := k.getInternalMap(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := dataFormat(cfgMap.Data[dataKey])
+	if err != nil {
+		return err
+	}
+	relabel := cfgMap.Labels[labelManagedBy] != managedByK8SKV
+	if version == formatVersion && !relabel {
+		return nil
+	}
+
+	if relabel {
+		if cfgMap.Labels == nil {
+			cfgMap.Labels = make(map[string]string)
+		}
+		for key, val := range k.bucketLabels(managedByK8SKV) {
+			cfgMap.Labels[key] = val
+		}
+	}
+
+	return k.saveInternalMap(ctx, cfgMap, im)
+}
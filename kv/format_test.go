@@ -0,0 +1,130 @@
+package kv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// encodeLegacy encodes data the way buckets were written before format header was added.
+func encodeLegacy(t *testing.T, data map[string][]byte) string {
+	bts, err := DefaultSerializer().Encode(&internalMap{Data: data})
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(bts)
+	w.Close()
+	return b64.EncodeToString(buf.Bytes())
+}
+
+func TestEncodeWritesHeader(t *testing.T) {
+	encoded, err := encodeInternalMap(DefaultSerializer(), map[string][]byte{"foo": []byte("bar")})
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	b, _ := b64.DecodeString(encoded)
+	h, _ := parseHeader(b)
+	if h.version != formatVersion || h.serializer != serializerGob || h.codec != codecGzip {
+		t.Errorf("unexpected header: %+v", h)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	legacy := encodeLegacy(t, map[string][]byte{"foo": []byte("bar")})
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{dataKey: legacy},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	val, err := kv.Get("foo")
+	if err != nil {
+		t.Fatalf("failed to read legacy bucket: %s", err)
+	}
+	if string(val) != "bar" {
+		t.Errorf("unexpected value: %s", val)
+	}
+
+	if err := kv.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if fi.updatedMap == nil {
+		t.Fatalf("expected bucket to be rewritten")
+	}
+	version, _ := dataFormat(fi.updatedMap.Data[dataKey])
+	if version != formatVersion {
+		t.Errorf("expected version %d, got %d", formatVersion, version)
+	}
+	if fi.updatedMap.Labels[labelManagedBy] != managedByK8SKV || fi.updatedMap.Labels[labelBucket] != "b1" {
+		t.Errorf("expected bucket to be relabeled, got: %v", fi.updatedMap.Labels)
+	}
+
+	// already migrated
+	fi.updatedMap = nil
+	if err := kv.Migrate(); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if fi.updatedMap != nil {
+		t.Errorf("migrated bucket shouldn't be rewritten")
+	}
+
+	val, err = kv.Get("foo")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if string(val) != "bar" {
+		t.Errorf("unexpected value: %s", val)
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	h := formatHeader{version: formatVersion + 1, serializer: serializerGob, codec: codecGzip}
+	_, err := decodeInternalMap(DefaultSerializer(), b64.EncodeToString(h.bytes()))
+	if err != ErrUnsupportedFormat {
+		t.Errorf("expected unsupported format error, got: %v", err)
+	}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Encode(source interface{}) ([]byte, error) {
+	return json.Marshal(source)
+}
+
+func (jsonSerializer) Decode(data []byte, target interface{}) error {
+	return json.Unmarshal(data, target)
+}
+
+func TestWrongSerializer(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	writer, _ := New(impl, "app", "b1", WithSerializer(jsonSerializer{}))
+	if err := writer.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	reader, _ := New(impl, "app", "b1", WithAutoRepair())
+	_, err := reader.Get("foo")
+	if !errors.Is(err, ErrUnsupportedFormat) || IsCorrupted(err) {
+		t.Fatalf("expected unsupported format error, got: %v", err)
+	}
+
+	quarantined, _ := impl.List(meta_v1.ListOptions{LabelSelector: labelManagedBy + "=" + managedByQuarantine})
+	if len(quarantined.Items) != 0 {
+		t.Errorf("intact data shouldn't be quarantined")
+	}
+	if val, err := writer.Get("foo"); err != nil || string(val) != "bar" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+}
@@ -3,16 +3,21 @@ package kv
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
 	"errors"
-	"io/ioutil"
 	"strings"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 func init() {
@@ -26,6 +31,16 @@ type internalMap struct {
 // errors
 var (
 	ErrNotFound = errors.New("not found")
+	// ErrReadOnly is returned by write operations of read-only handles, see WithReadOnly
+	ErrReadOnly = errors.New("bucket is read-only")
+	// ErrBucketNotFound is returned when bucket's config map doesn't exist and it isn't created automatically
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrBucketExists is returned by CreateBucket when bucket's config map already exists
+	ErrBucketExists = errors.New("bucket already exists")
+	// ErrBucketTooLarge is returned when encoded bucket data would exceed MaxBucketSize
+	ErrBucketTooLarge = errors.New("bucket data exceeds size limit")
+	// ErrBucketNotEmpty is returned by TeardownIfEmpty when bucket has entries
+	ErrBucketNotEmpty = errors.New("bucket is not empty")
 )
 
 var b64 = base64.StdEncoding
@@ -43,11 +58,36 @@ type KVDB interface {
 // Entry in ConfigMap is created based on bucket name and total size is limited to 1MB per bucket.
 // Operations are protected by an internal mutex so it's safe to use in a single node application.
 type KV struct {
-	app         string
-	bucket      string
-	implementer ConfigMapInterface
-	mu          *sync.RWMutex
-	serializer  Serializer
+	app             string
+	bucket          string
+	implementer     ConfigMapInterface
+	mu              *sync.RWMutex
+	serializer      Serializer
+	conflictRetries int
+	cache           *bucketCache
+	validators      []validator
+	metrics         *Metrics
+	tracer          trace.Tracer
+	ctx             context.Context
+	auditSink       AuditSink
+	auditIdentity   string
+	eventRecorder   EventRecorder
+	autoRepair      bool
+	readOnly        bool
+	strict          bool
+	owners          []meta_v1.OwnerReference
+	customLabels    map[string]string
+	annotations     map[string]string
+	legacyLabels    bool
+	softDelete      time.Duration
+	observed        *observation
+}
+
+// observation is bucket's config map as handle last read or wrote it, only metadata is kept. Copies of
+// the handle (see WithContext) share it.
+type observation struct {
+	mu     sync.Mutex
+	cfgMap *v1.ConfigMap
 }
 
 // ConfigMapInterface implements a subset of Kubernetes original ConfigMapInterface to provide
@@ -57,44 +97,236 @@ type ConfigMapInterface interface {
 	Create(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error)
 	Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error)
 	Delete(name string, options *meta_v1.DeleteOptions) error
+	List(opts meta_v1.ListOptions) (*v1.ConfigMapList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
 }
 
 // New creates a new instance of KV. Requires prepared ConfigMapInterface (provided by go-client), app and bucket names.
 // App name is used as a label to make it easier to distinguish different k8s-kv instances created by separate (or the same)
 // application. Bucket name is used to give a name to config map.
-func New(implementer ConfigMapInterface, app, bucket string) (*KV, error) {
+func New(implementer ConfigMapInterface, app, bucket string, opts ...Option) (*KV, error) {
+	return newKV(implementer, app, bucket, newConfig(opts))
+}
+
+func newKV(implementer ConfigMapInterface, app, bucket string, cfg config) (*KV, error) {
 	kv := &KV{
-		implementer: implementer,
-		app:         app,
-		bucket:      bucket,
-		mu:          &sync.RWMutex{},
-		serializer:  DefaultSerializer(),
+		implementer:     cfg.metrics.instrument(implementer, bucket),
+		app:             app,
+		bucket:          bucket,
+		mu:              &sync.RWMutex{},
+		serializer:      cfg.serializer,
+		conflictRetries: cfg.conflictRetries,
+		validators:      cfg.validators,
+		metrics:         cfg.metrics,
+		tracer:          cfg.tracerProvider.Tracer(tracerName),
+		ctx:             context.Background(),
+		auditSink:       cfg.auditSink,
+		auditIdentity:   cfg.auditIdentity,
+		eventRecorder:   cfg.eventRecorder,
+		autoRepair:      cfg.autoRepair,
+		readOnly:        cfg.readOnly,
+		strict:          cfg.strict,
+		owners:          cfg.owners,
+		customLabels:    cfg.labels,
+		annotations:     cfg.annotations,
+		legacyLabels:    cfg.legacyLabels,
+		softDelete:      cfg.softDelete,
+		observed:        &observation{},
+	}
+
+	if cfg.cache {
+		kv.cache = newBucketCache(kv.implementer, bucket)
 	}
 
-	_, err := kv.getMap()
+	_, err := kv.getMap(kv.ctx)
+	// missing bucket may still be created by someone else
+	if err != nil && err != ErrBucketNotFound {
+		kv.Close()
+		return nil, err
+	}
+
+	return kv, nil
+
+}
+
+// NewReadOnly creates a read-only instance of KV, see WithReadOnly.
+func NewReadOnly(implementer ConfigMapInterface, app, bucket string, opts ...Option) (*KV, error) {
+	return New(implementer, app, bucket, append(opts, WithReadOnly())...)
+}
+
+// CreateBucket creates bucket's config map and returns a handle to it. In strict mode (see WithStrict)
+// it's the only way to create buckets. ErrBucketExists is returned if bucket already exists.
+func CreateBucket(implementer ConfigMapInterface, app, bucket string, opts ...Option) (*KV, error) {
+	return createBucket(implementer, app, bucket, newConfig(opts))
+}
+
+func createBucket(implementer ConfigMapInterface, app, bucket string, cfg config) (*KV, error) {
+	if cfg.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// bucket is created below, newKV shouldn't do it
+	strict := cfg.strict
+	cfg.strict = true
+	kv, err := newKV(implementer, app, bucket, cfg)
 	if err != nil {
 		return nil, err
 	}
+	kv.strict = strict
 
+	if err := kv.create(); err != nil {
+		kv.Close()
+		return nil, err
+	}
 	return kv, nil
+}
 
+// create creates bucket's config map, ErrBucketExists is returned if it already exists.
+func (k *KV) create() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, err := k.newConfigMapsObject()
+	if apierrors.IsAlreadyExists(err) {
+		return ErrBucketExists
+	}
+	return err
+}
+
+// Exists checks whether bucket's config map exists, it never creates the bucket.
+func (k *KV) Exists() (bool, error) {
+	if k.cache != nil && k.cache.get() != nil {
+		return true, nil
+	}
+
+	_, err := k.implementer.Get(k.bucket, meta_v1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
 }
 
-// Teardown deletes configMap for this bucket. All bucket's data is lost.
-func (k *KV) Teardown() error {
-	return k.implementer.Delete(k.bucket, &meta_v1.DeleteOptions{})
+// Close stops background watchers started by this KV instance (if cache is enabled), closed handle
+// reads every time from API server.
+func (k *KV) Close() error {
+	if k.cache != nil {
+		k.cache.stop()
+	}
+	return nil
 }
 
-func (k *KV) getMap() (*v1.ConfigMap, error) {
+// Teardown deletes configMap for this bucket. All bucket's data is lost unless soft delete is enabled
+// (see WithSoftDelete). Bucket is deleted only if it wasn't modified or recreated since this handle last
+// read or wrote it, otherwise conflict error is returned. ErrBucketNotFound is returned if it doesn't exist.
+func (k *KV) Teardown() (err error) {
+	_, end := k.start(OpTeardown)
+	defer end(&err)
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	k.mu.Lock()
 	cfgMap, err := k.implementer.Get(k.bucket, meta_v1.GetOptions{})
+	if err == nil {
+		err = k.checkObserved(cfgMap)
+	}
+	if err == nil {
+		err = k.teardown(cfgMap)
+	} else if apierrors.IsNotFound(err) {
+		err = ErrBucketNotFound
+	}
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpTeardown, "", nil)
+	}
+	return err
+}
+
+// checkObserved returns conflict error if config map isn't the version this handle has last seen. Handles
+// that haven't seen the bucket accept any version.
+func (k *KV) checkObserved(cfgMap *v1.ConfigMap) error {
+	observed := k.lastObserved()
+	if observed.UID == "" || (observed.UID == cfgMap.UID && observed.ResourceVersion == cfgMap.ResourceVersion) {
+		return nil
+	}
+	return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, k.bucket,
+		errors.New("bucket was modified or recreated since it was read"))
+}
+
+// teardown deletes exactly the given version of bucket's config map, k.mu has to be held. Caller
+// audits the teardown after releasing k.mu.
+func (k *KV) teardown(cfgMap *v1.ConfigMap) error {
+	if k.cache != nil {
+		k.cache.invalidate()
+	}
+
+	var tombstone *v1.ConfigMap
+	if k.softDelete > 0 {
+		var err error
+		tombstone, err = k.tombstone(cfgMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := k.implementer.Delete(k.bucket, &meta_v1.DeleteOptions{
+		Preconditions: &meta_v1.Preconditions{
+			UID:             &cfgMap.UID,
+			ResourceVersion: &cfgMap.ResourceVersion,
+		},
+	})
+	if err != nil {
+		if tombstone != nil {
+			// bucket wasn't deleted by us, its copy isn't needed
+			k.implementer.Delete(tombstone.Name, &meta_v1.DeleteOptions{})
+		}
+		if apierrors.IsNotFound(err) {
+			return ErrBucketNotFound
+		}
+		return err
+	}
+
+	k.event(cfgMap, v1.EventTypeNormal, ReasonBucketDeleted, "bucket '%s' of app '%s' was deleted", k.bucket, k.app)
+	return nil
+}
+
+func (k *KV) getMap(ctx context.Context) (cfgMap *v1.ConfigMap, err error) {
+	_, span := k.startSpan(ctx, "fetch")
+	defer func() { endSpan(span, err) }()
+
+	if k.cache != nil {
+		if cfgMap := k.cache.get(); cfgMap != nil {
+			if cfgMap.Data == nil {
+				cfgMap.Data = make(map[string]string)
+			}
+			span.SetAttributes(attribute.Bool("k8s_kv.cached", true))
+			k.observe(cfgMap)
+			return cfgMap, nil
+		}
+	}
+
+	cfgMap, err = k.implementer.Get(k.bucket, meta_v1.GetOptions{})
 	if err != nil {
 		// creating
 		if apierrors.IsNotFound(err) {
+			if k.readOnly || k.strict {
+				return nil, ErrBucketNotFound
+			}
 			return k.newConfigMapsObject()
 		}
 		return nil, err
 	}
 
+	if k.cache != nil {
+		k.cache.set(cfgMap)
+	}
+	k.observe(cfgMap)
+
 	if cfgMap.Data == nil {
 		cfgMap.Data = make(map[string]string)
 	}
@@ -103,6 +335,34 @@ func (k *KV) getMap() (*v1.ConfigMap, error) {
 	return cfgMap, nil
 }
 
+// observe records version of bucket's config map this handle has read or written.
+func (k *KV) observe(cfgMap *v1.ConfigMap) {
+	observed := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            cfgMap.Name,
+			Namespace:       cfgMap.Namespace,
+			UID:             cfgMap.UID,
+			ResourceVersion: cfgMap.ResourceVersion,
+		},
+	}
+
+	k.observed.mu.Lock()
+	k.observed.cfgMap = observed
+	k.observed.mu.Unlock()
+}
+
+// lastObserved returns metadata of bucket's config map as this handle last read or wrote it, config map
+// without UID is returned if handle hasn't seen the bucket.
+func (k *KV) lastObserved() *v1.ConfigMap {
+	k.observed.mu.Lock()
+	defer k.observed.mu.Unlock()
+
+	if k.observed.cfgMap == nil {
+		return &v1.ConfigMap{ObjectMeta: meta_v1.ObjectMeta{Name: k.bucket}}
+	}
+	return k.observed.cfgMap
+}
+
 func encodeInternalMap(serializer Serializer, data map[string][]byte) (string, error) {
 	var im internalMap
 	im.Data = data
@@ -121,7 +381,13 @@ func encodeInternalMap(serializer Serializer, data map[string][]byte) (string, e
 	}
 	w.Close()
 
-	return b64.EncodeToString(buf.Bytes()), nil
+	h := formatHeader{
+		version:    formatVersion,
+		serializer: serializerID(serializer),
+		codec:      codecGzip,
+		checksum:   payloadChecksum(buf.Bytes()),
+	}
+	return b64.EncodeToString(append(h.bytes(), buf.Bytes()...)), nil
 }
 
 func decodeInternalMap(serializer Serializer, data string) (map[string][]byte, error) {
@@ -132,25 +398,33 @@ func decodeInternalMap(serializer Serializer, data string) (map[string][]byte, e
 
 	b, err := b64.DecodeString(data)
 	if err != nil {
-		return nil, err
+		return nil, &CorruptedError{Stage: "base64", Err: err}
 	}
 
-	r, err := gzip.NewReader(bytes.NewReader(b))
-	if err != nil {
-		return nil, err
-	}
-	decompressed, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	h, payload := parseHeader(b)
+	decode, ok := decoders[h.version]
+	if !ok {
+		return nil, ErrUnsupportedFormat
 	}
+	return decode(serializer, h, payload)
+}
 
-	var im internalMap
+const dataKey = "data"
 
-	err = serializer.Decode(decompressed, &im)
-	return im.Data, err
+// DecodeConfigMap decodes key/value pairs stored in a k8s-kv config map. It can be used by tools that
+// need to inspect bucket contents without going through KV (which would create missing buckets).
+func DecodeConfigMap(cfgMap *v1.ConfigMap) (map[string][]byte, error) {
+	return decodeConfigMap(DefaultSerializer(), cfgMap)
 }
 
-const dataKey = "data"
+// decodeConfigMap decodes config map's data.
+func decodeConfigMap(serializer Serializer, cfgMap *v1.ConfigMap) (map[string][]byte, error) {
+	im, err := decodeInternalMap(serializer, cfgMap.Data[dataKey])
+	if cerr, ok := err.(*CorruptedError); ok {
+		cerr.Bucket = cfgMap.Name
+	}
+	return im, err
+}
 
 func (k *KV) newConfigMapsObject() (*v1.ConfigMap, error) {
 
@@ -158,16 +432,25 @@ func (k *KV) newConfigMapsObject() (*v1.ConfigMap, error) {
 
 	lbs.init()
 
-	// apply labels
-	lbs.set("BUCKET", k.bucket)
-	lbs.set("APP", k.app)
-	lbs.set("OWNER", "K8S-KV")
+	// custom labels first so they can't override k8s-kv's own
+	lbs.fromMap(k.customLabels)
+	lbs.fromMap(k.bucketLabels(managedByK8SKV))
+
+	var annotations map[string]string
+	if len(k.annotations) > 0 {
+		annotations = make(map[string]string, len(k.annotations))
+		for key, val := range k.annotations {
+			annotations[key] = val
+		}
+	}
 
 	// create and return configmap object
 	cfgMap := &v1.ConfigMap{
 		ObjectMeta: meta_v1.ObjectMeta{
-			Name:   k.bucket,
-			Labels: lbs.toMap(),
+			Name:            k.bucket,
+			Labels:          lbs.toMap(),
+			Annotations:     annotations,
+			OwnerReferences: k.owners,
 		},
 		Data: map[string]string{
 			dataKey: "",
@@ -178,60 +461,207 @@ func (k *KV) newConfigMapsObject() (*v1.ConfigMap, error) {
 	if err != nil {
 		return nil, err
 	}
+	k.observe(cm)
+	k.event(cm, v1.EventTypeNormal, ReasonBucketCreated, "bucket '%s' of app '%s' was created", k.bucket, k.app)
 
 	return cm, nil
 }
 
-func (k *KV) saveInternalMap(cfgMap *v1.ConfigMap, im map[string][]byte) error {
+func (k *KV) saveInternalMap(ctx context.Context, cfgMap *v1.ConfigMap, im map[string][]byte) error {
+	_, span := k.startSpan(ctx, "encode")
 	encoded, err := encodeInternalMap(k.serializer, im)
+	span.SetAttributes(attribute.Int("k8s_kv.keys", len(im)), attribute.Int("k8s_kv.size", len(encoded)))
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
+	if len(encoded) > MaxBucketSize {
+		return ErrBucketTooLarge
+	}
 
 	cfgMap.Data[dataKey] = encoded
+	k.metrics.observeBucketSize(k.bucket, im, encoded)
+	k.checkSize(cfgMap, encoded)
 
-	return k.saveMap(cfgMap)
+	return k.saveMap(ctx, cfgMap)
+}
+
+// getInternalMap fetches and decodes bucket's data, k.mu has to be held for writing: corrupted bucket
+// is repaired when auto repair is enabled.
+func (k *KV) getInternalMap(ctx context.Context) (*v1.ConfigMap, map[string][]byte, error) {
+	cfgMap, im, err := k.loadInternalMap(ctx)
+	var cerr *CorruptedError
+	if errors.As(err, &cerr) && k.autoRepair && !k.readOnly {
+		return k.repairCorrupted(ctx, cfgMap, cerr)
+	}
+	return cfgMap, im, err
 }
 
-func (k *KV) getInternalMap() (*v1.ConfigMap, map[string][]byte, error) {
-	cfgMap, err := k.getMap()
+// readInternalMap fetches and decodes bucket's data for read operations, it takes k.mu itself. Reads
+// share the lock, corrupted bucket is repaired under the write lock (see WithAutoRepair).
+func (k *KV) readInternalMap(ctx context.Context) (map[string][]byte, error) {
+	k.mu.RLock()
+	_, im, err := k.loadInternalMap(ctx)
+	k.mu.RUnlock()
+	if !errors.Is(err, ErrCorrupted) || !k.autoRepair || k.readOnly {
+		return im, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// bucket is fetched again, it may have been repaired by someone else in the meantime
+	_, im, err = k.getInternalMap(ctx)
+	return im, err
+}
+
+// loadInternalMap fetches and decodes bucket's data, config map is returned even if data is corrupted.
+func (k *KV) loadInternalMap(ctx context.Context) (*v1.ConfigMap, map[string][]byte, error) {
+	cfgMap, err := k.getMap(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	im, err := decodeInternalMap(k.serializer, cfgMap.Data[dataKey])
+	_, span := k.startSpan(ctx, "decode")
+	im, err := decodeConfigMap(k.serializer, cfgMap)
+	span.SetAttributes(attribute.Int("k8s_kv.keys", len(im)), attribute.Int("k8s_kv.size", len(cfgMap.Data[dataKey])))
+	endSpan(span, err)
 	if err != nil {
-		return nil, nil, err
+		k.event(cfgMap, v1.EventTypeWarning, ReasonBucketDecodeFailed, "failed to decode bucket data: %s", err)
+		if cerr, ok := err.(*CorruptedError); ok {
+			cerr.Bucket = k.bucket
+		}
+		return cfgMap, nil, err
 	}
+	k.metrics.observeBucketSize(k.bucket, im, cfgMap.Data[dataKey])
 	return cfgMap, im, nil
 }
 
-func (k *KV) saveMap(cfgMap *v1.ConfigMap) error {
-	_, err := k.implementer.Update(cfgMap)
+func (k *KV) saveMap(ctx context.Context, cfgMap *v1.ConfigMap) error {
+	_, span := k.startSpan(ctx, "save")
+	updated, err := k.implementer.Update(cfgMap)
+	endSpan(span, err)
+	if k.cache != nil {
+		if err != nil {
+			k.cache.invalidate()
+		} else {
+			k.cache.set(updated)
+		}
+	}
+	if err == nil {
+		k.observe(updated)
+	}
 	return err
 }
 
+// update performs read-modify-write of bucket's internal map. Update is retried if config map was
+// changed by someone else in the meantime so fn has to be safe to call multiple times. If fn returns
+// an error, update is aborted and nothing is saved.
+func (k *KV) update(ctx context.Context, fn func(im map[string][]byte) error) error {
+	return k.retryConflicts(func() error {
+		cfgMap, im, err := k.getInternalMap(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(im); err != nil {
+			return err
+		}
+
+		return k.saveInternalMap(ctx, cfgMap, im)
+	})
+}
+
+// updateMap performs read-modify-write of bucket's config map, same as update but for config map's metadata.
+func (k *KV) updateMap(ctx context.Context, fn func(cfgMap *v1.ConfigMap) error) error {
+	return k.retryConflicts(func() error {
+		cfgMap, err := k.getMap(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(cfgMap); err != nil {
+			return err
+		}
+
+		return k.saveMap(ctx, cfgMap)
+	})
+}
+
+// retryConflicts calls write until it doesn't fail with a conflict or retries run out.
+func (k *KV) retryConflicts(write func() error) error {
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err != nil && apierrors.IsConflict(err) {
+			if attempt < k.conflictRetries {
+				k.metrics.observeConflictRetry(k.bucket)
+				continue
+			}
+			if attempt > 0 {
+				k.event(k.lastObserved(), v1.EventTypeWarning, ReasonBucketConflicts, "update failed after %d conflicting writes", attempt+1)
+			}
+		}
+		return err
+	}
+}
+
 // Put saves key/value pair into a bucket. Value can be any []byte value (ie: encoded JSON/GOB)
-func (k *KV) Put(key string, value []byte) error {
-	k.mu.Lock()
-	defer k.mu.Unlock()
+func (k *KV) Put(key string, value []byte) (err error) {
+	ctx, end := k.start(OpPut)
+	defer end(&err)
 
-	cfgMap, im, err := k.getInternalMap()
-	if err != nil {
+	if err := k.validate(key, value); err != nil {
 		return err
 	}
 
-	im[key] = value
+	k.mu.Lock()
+	err = k.update(ctx, func(im map[string][]byte) error {
+		im[key] = value
+		return nil
+	})
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpPut, key, value)
+	}
+	return err
+}
+
+// PutMany saves multiple key/value pairs into a bucket with a single config map update.
+func (k *KV) PutMany(data map[string][]byte) (err error) {
+	ctx, end := k.start(OpPutMany)
+	defer end(&err)
+
+	for key, value := range data {
+		if err := k.validate(key, value); err != nil {
+			return err
+		}
+	}
+
+	k.mu.Lock()
+	err = k.update(ctx, func(im map[string][]byte) error {
+		for key, value := range data {
+			im[key] = value
+		}
+		return nil
+	})
+	k.mu.Unlock()
 
-	return k.saveInternalMap(cfgMap, im)
+	if err == nil {
+		k.auditMany(OpPutMany, data)
+	}
+	return err
 }
 
 // Get retrieves value from the key/value store bucket or returns ErrNotFound error if it was not found.
 func (k *KV) Get(key string) (value []byte, err error) {
-	k.mu.RLock()
-	defer k.mu.RUnlock()
+	ctx, end := k.start(OpGet)
+	defer end(&err)
 
-	_, im, err := k.getInternalMap()
+	im, err := k.readInternalMap(ctx)
 	if err != nil {
 		return
 	}
@@ -246,26 +676,29 @@ func (k *KV) Get(key string) (value []byte, err error) {
 }
 
 // Delete removes entry from the KV store bucket.
-func (k *KV) Delete(key string) error {
-	k.mu.Lock()
-	defer k.mu.Unlock()
+func (k *KV) Delete(key string) (err error) {
+	ctx, end := k.start(OpDelete)
+	defer end(&err)
 
-	cfgMap, im, err := k.getInternalMap()
-	if err != nil {
-		return err
+	k.mu.Lock()
+	err = k.update(ctx, func(im map[string][]byte) error {
+		delete(im, key)
+		return nil
+	})
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpDelete, key, nil)
 	}
-
-	delete(im, key)
-
-	return k.saveInternalMap(cfgMap, im)
+	return err
 }
 
 // List retrieves all entries that match specific prefix
 func (k *KV) List(prefix string) (data map[string][]byte, err error) {
-	k.mu.RLock()
-	defer k.mu.RUnlock()
+	ctx, end := k.start(OpList)
+	defer end(&err)
 
-	_, im, err := k.getInternalMap()
+	im, err := k.readInternalMap(ctx)
 	if err != nil {
 		return
 	}
@@ -279,6 +712,59 @@ func (k *KV) List(prefix string) (data map[string][]byte, err error) {
 	return
 }
 
+// label keys and values that identify bucket config maps
+const (
+	labelBucket    = "k8s-kv/bucket"
+	labelApp       = "app.kubernetes.io/part-of"
+	labelManagedBy = "app.kubernetes.io/managed-by"
+	managedByK8SKV = "k8s-kv"
+	// managedByQuarantine marks copies of corrupted buckets made by Repair
+	managedByQuarantine = "k8s-kv-quarantine"
+)
+
+// legacy labels applied by older versions, see WithLegacyLabels
+const (
+	legacyLabelBucket = "BUCKET"
+	legacyLabelApp    = "APP"
+	legacyLabelOwner  = "OWNER"
+	legacyOwnerK8SKV  = "K8S-KV"
+	// legacyOwnerQuarantine marks copies of corrupted buckets made by Repair
+	legacyOwnerQuarantine = "K8S-KV-QUARANTINE"
+)
+
+// bucketLabels returns labels that identify config map of the bucket, managedBy is either
+// managedByK8SKV or managedByQuarantine.
+func (k *KV) bucketLabels(managedBy string) labels {
+	var lbs labels
+	lbs.init()
+	lbs.set(labelBucket, k.bucket)
+	lbs.set(labelApp, k.app)
+	lbs.set(labelManagedBy, managedBy)
+
+	if k.legacyLabels {
+		lbs.set(legacyLabelBucket, k.bucket)
+		lbs.set(legacyLabelApp, k.app)
+		if managedBy == managedByQuarantine {
+			lbs.set(legacyLabelOwner, legacyOwnerQuarantine)
+		} else {
+			lbs.set(legacyLabelOwner, legacyOwnerK8SKV)
+		}
+	}
+	return lbs
+}
+
+// Labels returns labels of bucket's config map.
+func (k *KV) Labels() (map[string]string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	cfgMap, err := k.getMap(k.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfgMap.Labels, nil
+}
+
 // labels is a map of key value pairs to be included as metadata in a configmap object.
 type labels map[string]string
 
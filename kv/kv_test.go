@@ -2,33 +2,60 @@ package kv
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"k8s.io/api/core/v1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 type fakeImplementer struct {
 	getcfgMap *v1.ConfigMap
+	getErr    error
+	getCount  int
 
 	createdMap *v1.ConfigMap
+	createErr  error
 	updatedMap *v1.ConfigMap
 
 	deletedName    string
 	deletedOptions *meta_v1.DeleteOptions
+
+	listMaps    []v1.ConfigMap
+	listOptions meta_v1.ListOptions
+
+	// errors returned by subsequent Update calls
+	updateErrs []error
+
+	watcher *watch.FakeWatcher
 }
 
 func (i *fakeImplementer) Get(name string, options meta_v1.GetOptions) (*v1.ConfigMap, error) {
+	i.getCount++
+	if i.getErr != nil {
+		return nil, i.getErr
+	}
 	return i.getcfgMap, nil
 }
 
 func (i *fakeImplementer) Create(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if i.createErr != nil {
+		return nil, i.createErr
+	}
 	i.createdMap = cfgMap
 	return i.createdMap, nil
 }
 
 func (i *fakeImplementer) Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	if len(i.updateErrs) > 0 {
+		err := i.updateErrs[0]
+		i.updateErrs = i.updateErrs[1:]
+		return nil, err
+	}
 	i.updatedMap = cfgMap
 	return i.updatedMap, nil
 }
@@ -39,6 +66,18 @@ func (i *fakeImplementer) Delete(name string, options *meta_v1.DeleteOptions) er
 	return nil
 }
 
+func (i *fakeImplementer) List(opts meta_v1.ListOptions) (*v1.ConfigMapList, error) {
+	i.listOptions = opts
+	return &v1.ConfigMapList{Items: i.listMaps}, nil
+}
+
+func (i *fakeImplementer) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	if i.watcher == nil {
+		i.watcher = watch.NewFake()
+	}
+	return i.watcher, nil
+}
+
 func TestGetMap(t *testing.T) {
 	fi := &fakeImplementer{
 		getcfgMap: &v1.ConfigMap{
@@ -52,7 +91,7 @@ func TestGetMap(t *testing.T) {
 		t.Fatalf("failed to get kv: %s", err)
 	}
 
-	cfgMap, err := kv.getMap()
+	cfgMap, err := kv.getMap(kv.ctx)
 	if err != nil {
 		t.Fatalf("failed to get map: %s", err)
 	}
@@ -77,9 +116,9 @@ func TestGet(t *testing.T) {
 		t.Fatalf("failed to get kv: %s", err)
 	}
 
-	cfgMap, _ := kv.getMap()
+	cfgMap, _ := kv.getMap(kv.ctx)
 
-	kv.saveInternalMap(cfgMap, im)
+	kv.saveInternalMap(kv.ctx, cfgMap, im)
 
 	val, err := kv.Get("foo")
 	if err != nil {
@@ -110,9 +149,9 @@ func TestUpdate(t *testing.T) {
 		t.Fatalf("failed to get kv: %s", err)
 	}
 
-	cfgMap, _ := kv.getMap()
+	cfgMap, _ := kv.getMap(kv.ctx)
 
-	kv.saveInternalMap(cfgMap, im)
+	kv.saveInternalMap(kv.ctx, cfgMap, im)
 
 	err = kv.Put("b", []byte("updated"))
 	if err != nil {
@@ -154,3 +193,227 @@ func TestEncodeInternal(t *testing.T) {
 	}
 
 }
+
+func TestPutMany(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	err = kv.PutMany(map[string][]byte{
+		"a": []byte("a-val"),
+		"b": []byte("b-val"),
+	})
+	if err != nil {
+		t.Fatalf("failed to put many: %s", err)
+	}
+
+	stored, err := DecodeConfigMap(fi.updatedMap)
+	if err != nil {
+		t.Fatalf("failed to decode config map: %s", err)
+	}
+
+	if len(stored) != 2 {
+		t.Errorf("expected 2 items, got: %d", len(stored))
+	}
+
+	if string(stored["b"]) != "b-val" {
+		t.Errorf("expected 'b-val' but got: %s", string(stored["b"]))
+	}
+}
+
+func TestPutConflictRetry(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "b1", fmt.Errorf("modified"))
+	fi.updateErrs = []error{conflict, conflict}
+
+	err = kv.Put("foo", []byte("bar"))
+	if err != nil {
+		t.Fatalf("expected put to succeed after retries, got: %s", err)
+	}
+
+	// initial get in New and 3 attempts
+	if fi.getCount != 4 {
+		t.Errorf("expected 4 gets, got: %d", fi.getCount)
+	}
+
+	fi.updateErrs = []error{conflict}
+	kv.conflictRetries = 0
+
+	err = kv.Put("foo", []byte("bar"))
+	if !apierrors.IsConflict(err) {
+		t.Errorf("expected conflict error, got: %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	fi := &fakeImplementer{
+		getErr: apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "b1"),
+	}
+	kv, err := NewReadOnly(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	if fi.createdMap != nil {
+		t.Errorf("read-only kv shouldn't create buckets")
+	}
+
+	_, err = kv.Get("foo")
+	if err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+
+	fi.getErr = nil
+	fi.getcfgMap = &v1.ConfigMap{
+		Data: map[string]string{},
+	}
+
+	_, err = kv.Get("foo")
+	if err != ErrNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+
+	if err := kv.Put("foo", []byte("bar")); err != ErrReadOnly {
+		t.Errorf("expected read-only error, got: %v", err)
+	}
+	if err := kv.Delete("foo"); err != ErrReadOnly {
+		t.Errorf("expected read-only error, got: %v", err)
+	}
+	if err := kv.Teardown(); err != ErrReadOnly {
+		t.Errorf("expected read-only error, got: %v", err)
+	}
+	if fi.updatedMap != nil || fi.deletedName != "" {
+		t.Errorf("read-only kv shouldn't modify buckets")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "b1")
+	fi := &fakeImplementer{
+		getErr: notFound,
+	}
+	kv, err := New(fi, "app", "b1", WithStrict())
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	if err := kv.Put("foo", []byte("bar")); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+	if fi.createdMap != nil {
+		t.Errorf("strict kv shouldn't create buckets")
+	}
+
+	exists, err := kv.Exists()
+	if err != nil || exists {
+		t.Errorf("expected bucket to be missing, got: %t, %v", exists, err)
+	}
+
+	created, err := CreateBucket(fi, "app", "b1", WithStrict())
+	if err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+	if fi.createdMap == nil || fi.createdMap.Name != "b1" {
+		t.Fatalf("expected bucket to be created")
+	}
+	if !created.strict {
+		t.Errorf("created bucket should stay strict")
+	}
+
+	fi.getErr = nil
+	fi.getcfgMap = fi.createdMap
+
+	exists, err = kv.Exists()
+	if err != nil || !exists {
+		t.Errorf("expected bucket to exist, got: %t, %v", exists, err)
+	}
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Errorf("failed to put: %s", err)
+	}
+
+	fi.createErr = apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "b1")
+	_, err = CreateBucket(fi, "app", "b1")
+	if err != ErrBucketExists {
+		t.Errorf("expected bucket exists error, got: %v", err)
+	}
+}
+
+func TestBucketLabels(t *testing.T) {
+	fi := &fakeImplementer{
+		getErr: apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "b1"),
+	}
+	kv, err := New(fi, "app", "b1",
+		WithLabels(map[string]string{"team": "infra", labelBucket: "override"}),
+		WithAnnotations(map[string]string{"description": "sessions"}),
+		WithLegacyLabels(),
+	)
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	expected := map[string]string{
+		"team":                         "infra",
+		"k8s-kv/bucket":                "b1",
+		"app.kubernetes.io/part-of":    "app",
+		"app.kubernetes.io/managed-by": "k8s-kv",
+		"BUCKET":                       "b1",
+		"APP":                          "app",
+		"OWNER":                        "K8S-KV",
+	}
+
+	fi.getErr = nil
+	fi.getcfgMap = fi.createdMap
+	lbs, err := kv.Labels()
+	if err != nil {
+		t.Fatalf("failed to get labels: %s", err)
+	}
+	if len(lbs) != len(expected) {
+		t.Errorf("unexpected labels: %v", lbs)
+	}
+	for key, val := range expected {
+		if lbs[key] != val {
+			t.Errorf("expected label %s=%s, got: %s", key, val, lbs[key])
+		}
+	}
+	if fi.createdMap.Annotations["description"] != "sessions" {
+		t.Errorf("unexpected annotations: %v", fi.createdMap.Annotations)
+	}
+}
+
+func TestPutBucketTooLarge(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	// incompressible data over the limit
+	big := make([]byte, MaxBucketSize)
+	rand.Read(big)
+
+	err = kv.Put("big", big)
+	if err != ErrBucketTooLarge {
+		t.Fatalf("expected bucket too large error, got: %v", err)
+	}
+	if fi.updatedMap != nil {
+		t.Errorf("oversized bucket shouldn't be sent to API server")
+	}
+}
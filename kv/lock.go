@@ -0,0 +1,265 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrNotLockOwner is returned when lock is held by someone else
+var ErrNotLockOwner = errors.New("lock is not held by this owner")
+
+// lockRecord is stored in the bucket under lock's key.
+type lockRecord struct {
+	Owner    string
+	Acquired time.Time
+	Expires  time.Time
+}
+
+// Locker is a named lock shared by multiple processes (or nodes) through a bucket. Lock record with owner
+// and lease expiry is written to the bucket, config map's ResourceVersion ensures that only one owner can
+// acquire it. While lock is held its lease is renewed in the background, locks of owners that stopped
+// renewing them are taken over once their lease expires.
+type Locker struct {
+	// RenewInterval is how often lease is renewed while lock is held, defaults to a third of TTL.
+	// Set it to 0 to disable background renewal and renew lease manually with Renew().
+	RenewInterval time.Duration
+	// RetryInterval is how often Lock tries to acquire a lock held by someone else, defaults to a third of TTL
+	RetryInterval time.Duration
+
+	kv    *KV
+	key   string
+	owner string
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	held    bool
+	expires time.Time
+	stopCh  chan struct{}
+	lostCh  chan struct{}
+}
+
+// NewLocker creates a lock stored in the bucket under name key. Owner identifies lock holder and has to be
+// unique between processes (ie: pod name), lease of the lock expires after ttl unless it's renewed.
+func NewLocker(kv *KV, name, owner string, ttl time.Duration) *Locker {
+	return &Locker{
+		RenewInterval: ttl / 3,
+		RetryInterval: ttl / 3,
+		kv:            kv,
+		key:           name,
+		owner:         owner,
+		ttl:           ttl,
+		now:           time.Now,
+	}
+}
+
+// TryLock tries to acquire the lock without waiting, it returns true if lock was acquired. Calling TryLock
+// while lock is already held by this owner extends its lease.
+func (l *Locker) TryLock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	acquired, err := l.acquire()
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	if !l.held {
+		l.held = true
+		l.stopCh = make(chan struct{})
+		l.lostCh = make(chan struct{})
+		if l.RenewInterval > 0 {
+			go l.renewLoop(l.stopCh, l.lostCh)
+		}
+	}
+	return true, nil
+}
+
+// Lock blocks until the lock is acquired or context is done.
+func (l *Locker) Lock(ctx context.Context) error {
+	for {
+		acquired, err := l.TryLock()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.RetryInterval):
+		}
+	}
+}
+
+// Unlock releases the lock. ErrNotLockOwner is returned if lock is held by someone else.
+func (l *Locker) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRenewing()
+
+	l.kv.mu.Lock()
+	defer l.kv.mu.Unlock()
+
+	return l.kv.update(l.kv.ctx, func(im map[string][]byte) error {
+		record, err := l.decodeRecord(im)
+		if err != nil {
+			return err
+		}
+		if record == nil || record.Owner != l.owner {
+			return ErrNotLockOwner
+		}
+
+		delete(im, l.key)
+		return nil
+	})
+}
+
+// Renew extends lease of the held lock. ErrNotLockOwner is returned if lock was taken by someone else.
+func (l *Locker) Renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.renew()
+}
+
+// Lost returns a channel that's closed when the lock is lost because its lease couldn't be renewed.
+// Channel is replaced every time lock is acquired again, it's nil if lock was never acquired and it's
+// never closed when background renewal is disabled.
+func (l *Locker) Lost() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lostCh
+}
+
+// Owner returns current owner of the lock or empty string if lock is free.
+func (l *Locker) Owner() (string, error) {
+	im, err := l.kv.readInternalMap(l.kv.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	record, err := l.decodeRecord(im)
+	if err != nil || record == nil || !record.Expires.After(l.now()) {
+		return "", err
+	}
+	return record.Owner, nil
+}
+
+// renew extends lease of the held lock. Conflicts are returned as is: they may be caused by unrelated
+// writes to the bucket, lock is lost only if its record names another owner.
+func (l *Locker) renew() error {
+	return l.write()
+}
+
+// acquire writes lock record if lock is free, expired or already owned by this owner.
+func (l *Locker) acquire() (bool, error) {
+	err := l.write()
+	switch {
+	case err == ErrNotLockOwner, apierrors.IsConflict(err):
+		// someone else holds the lock or got it first
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+// write saves lock record of this owner, ErrNotLockOwner is returned if lock is held by someone else.
+func (l *Locker) write() error {
+	l.kv.mu.Lock()
+	defer l.kv.mu.Unlock()
+
+	var expires time.Time
+	err := l.kv.update(l.kv.ctx, func(im map[string][]byte) error {
+		record, err := l.decodeRecord(im)
+		if err != nil {
+			return err
+		}
+
+		now := l.now()
+		if record != nil && record.Owner != l.owner && record.Expires.After(now) {
+			return ErrNotLockOwner
+		}
+
+		if record == nil || record.Owner != l.owner {
+			record = &lockRecord{Owner: l.owner, Acquired: now}
+		}
+		record.Expires = now.Add(l.ttl)
+		expires = record.Expires
+
+		encoded, err := l.kv.serializer.Encode(record)
+		if err != nil {
+			return err
+		}
+		im[l.key] = encoded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.expires = expires
+	return nil
+}
+
+func (l *Locker) decodeRecord(im map[string][]byte) (*lockRecord, error) {
+	data, ok := im[l.key]
+	if !ok {
+		return nil, nil
+	}
+
+	var record lockRecord
+	if err := l.kv.serializer.Decode(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (l *Locker) renewLoop(stopCh, lostCh chan struct{}) {
+	ticker := time.NewTicker(l.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		select {
+		case <-stopCh:
+			l.mu.Unlock()
+			return
+		default:
+		}
+
+		err := l.renew()
+		// transient errors are retried until lease expires
+		if err == ErrNotLockOwner || (err != nil && !l.expires.After(l.now())) {
+			l.held = false
+			close(lostCh)
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+	}
+}
+
+// stopRenewing stops background renewal, l.mu has to be held.
+func (l *Locker) stopRenewing() {
+	if !l.held {
+		return
+	}
+	l.held = false
+	close(l.stopCh)
+}
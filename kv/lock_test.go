@@ -0,0 +1,161 @@
+package kv
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newLockTestKV(t *testing.T) *KV {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "locks")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	return kv
+}
+
+func TestLockerTryLock(t *testing.T) {
+	kv := newLockTestKV(t)
+	clock := &fakeClock{now: time.Now()}
+
+	a := NewLocker(kv, "cron", "pod-a", time.Minute)
+	a.now = clock.Now
+	b := NewLocker(kv, "cron", "pod-b", time.Minute)
+	b.now = clock.Now
+
+	acquired, err := a.TryLock()
+	if err != nil || !acquired {
+		t.Fatalf("expected pod-a to acquire lock, got: %v, %v", acquired, err)
+	}
+	defer a.Unlock()
+
+	acquired, err = b.TryLock()
+	if err != nil || acquired {
+		t.Fatalf("expected pod-b to fail to acquire lock, got: %v, %v", acquired, err)
+	}
+
+	owner, err := b.Owner()
+	if err != nil {
+		t.Fatalf("failed to get owner: %s", err)
+	}
+	if owner != "pod-a" {
+		t.Errorf("expected 'pod-a' to be owner, got: %s", owner)
+	}
+
+	err = b.Unlock()
+	if err != ErrNotLockOwner {
+		t.Errorf("expected ErrNotLockOwner, got: %v", err)
+	}
+
+	err = a.Unlock()
+	if err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+
+	acquired, err = b.TryLock()
+	if err != nil || !acquired {
+		t.Fatalf("expected pod-b to acquire released lock, got: %v, %v", acquired, err)
+	}
+	b.Unlock()
+}
+
+func TestLockerStealExpired(t *testing.T) {
+	kv := newLockTestKV(t)
+	clock := &fakeClock{now: time.Now()}
+
+	a := NewLocker(kv, "cron", "pod-a", time.Minute)
+	a.now = clock.Now
+	a.RenewInterval = 10 * time.Millisecond
+	b := NewLocker(kv, "cron", "pod-b", time.Minute)
+	b.now = clock.Now
+
+	acquired, err := a.TryLock()
+	if err != nil || !acquired {
+		t.Fatalf("expected pod-a to acquire lock, got: %v, %v", acquired, err)
+	}
+	lost := a.Lost()
+
+	// pod-a stops renewing and its lease expires
+	a.mu.Lock()
+	clock.Add(2 * time.Minute)
+
+	acquired, err = b.TryLock()
+	if err != nil || !acquired {
+		t.Fatalf("expected pod-b to take over expired lock, got: %v, %v", acquired, err)
+	}
+	defer b.Unlock()
+	a.mu.Unlock()
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatalf("expected pod-a to notice lost lock")
+	}
+
+	err = a.Renew()
+	if err != ErrNotLockOwner {
+		t.Errorf("expected ErrNotLockOwner, got: %v", err)
+	}
+}
+
+func TestLockerRenewConflicts(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "locks", WithConflictRetries(0))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	a := NewLocker(kv, "cron", "pod-a", time.Minute)
+	a.RenewInterval = 0
+
+	acquired, err := a.TryLock()
+	if err != nil || !acquired {
+		t.Fatalf("expected pod-a to acquire lock, got: %v, %v", acquired, err)
+	}
+	defer a.Unlock()
+
+	// unrelated writes to the bucket keep conflicting with renewal
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "locks", fmt.Errorf("modified"))
+	fi.updateErrs = []error{conflict}
+
+	err = a.Renew()
+	if !apierrors.IsConflict(err) {
+		t.Errorf("expected conflict error, got: %v", err)
+	}
+
+	err = a.Renew()
+	if err != nil {
+		t.Errorf("expected lock to be still held, got: %v", err)
+	}
+}
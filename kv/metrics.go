@@ -0,0 +1,211 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Metrics collects Prometheus metrics of bucket operations. It implements prometheus.Collector so
+// it has to be registered by the app:
+//
+//	metrics := kv.NewMetrics()
+//	prometheus.MustRegister(metrics)
+//	db, err := kv.Open(impl, "my-app", kv.WithMetrics(metrics))
+type Metrics struct {
+	operations       *prometheus.CounterVec
+	operationErrors  *prometheus.CounterVec
+	operationSeconds *prometheus.HistogramVec
+	apiRequests      *prometheus.CounterVec
+	apiSeconds       *prometheus.HistogramVec
+	conflictRetries  *prometheus.CounterVec
+	bucketSize       *prometheus.GaugeVec
+	compressionRatio *prometheus.GaugeVec
+}
+
+// NewMetrics creates metrics, it can be shared by multiple buckets.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "k8s_kv",
+			Name:      "operations_total",
+			Help:      "Number of bucket operations.",
+		}, []string{"bucket", "op"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "k8s_kv",
+			Name:      "operation_errors_total",
+			Help:      "Number of failed bucket operations.",
+		}, []string{"bucket", "op"}),
+		operationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "k8s_kv",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of bucket operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"bucket", "op"}),
+		apiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "k8s_kv",
+			Name:      "api_requests_total",
+			Help:      "Number of config map API requests.",
+		}, []string{"bucket", "method", "result"}),
+		apiSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "k8s_kv",
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of config map API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"bucket", "method"}),
+		conflictRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "k8s_kv",
+			Name:      "conflict_retries_total",
+			Help:      "Number of writes retried because of conflicting config map updates.",
+		}, []string{"bucket"}),
+		bucketSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "k8s_kv",
+			Name:      "bucket_size_bytes",
+			Help:      "Size of encoded bucket data, config maps are limited to 1MB.",
+		}, []string{"bucket"}),
+		compressionRatio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "k8s_kv",
+			Name:      "bucket_compression_ratio",
+			Help:      "Ratio between size of bucket keys and values and size of encoded bucket data.",
+		}, []string{"bucket"}),
+	}
+}
+
+// WithMetrics enables collection of Prometheus metrics.
+func WithMetrics(metrics *Metrics) Option {
+	return func(c *config) {
+		c.metrics = metrics
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.operations,
+		m.operationErrors,
+		m.operationSeconds,
+		m.apiRequests,
+		m.apiSeconds,
+		m.conflictRetries,
+		m.bucketSize,
+		m.compressionRatio,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// methods below are safe to call on nil *Metrics so KV doesn't have to check whether metrics are enabled
+
+func (m *Metrics) observeOperation(bucket string, op Op, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.operations.WithLabelValues(bucket, string(op)).Inc()
+	m.operationSeconds.WithLabelValues(bucket, string(op)).Observe(time.Since(start).Seconds())
+	// missing keys are not operation failures
+	if err != nil && err != ErrNotFound {
+		m.operationErrors.WithLabelValues(bucket, string(op)).Inc()
+	}
+}
+
+func (m *Metrics) observeConflictRetry(bucket string) {
+	if m == nil {
+		return
+	}
+	m.conflictRetries.WithLabelValues(bucket).Inc()
+}
+
+func (m *Metrics) observeBucketSize(bucket string, im map[string][]byte, encoded string) {
+	if m == nil {
+		return
+	}
+	m.bucketSize.WithLabelValues(bucket).Set(float64(len(encoded)))
+
+	if len(encoded) == 0 {
+		return
+	}
+	var raw int
+	for key, val := range im {
+		raw += len(key) + len(val)
+	}
+	m.compressionRatio.WithLabelValues(bucket).Set(float64(raw) / float64(len(encoded)))
+}
+
+func (m *Metrics) observeAPIRequest(bucket, method string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.apiRequests.WithLabelValues(bucket, method, result).Inc()
+	m.apiSeconds.WithLabelValues(bucket, method).Observe(time.Since(start).Seconds())
+}
+
+// instrument wraps implementer to count API round-trips.
+func (m *Metrics) instrument(implementer ConfigMapInterface, bucket string) ConfigMapInterface {
+	if m == nil {
+		return implementer
+	}
+	return &instrumentedImplementer{ConfigMapInterface: implementer, metrics: m, bucket: bucket}
+}
+
+type instrumentedImplementer struct {
+	ConfigMapInterface
+	metrics *Metrics
+	bucket  string
+}
+
+func (i *instrumentedImplementer) Get(name string, options meta_v1.GetOptions) (*v1.ConfigMap, error) {
+	start := time.Now()
+	cfgMap, err := i.ConfigMapInterface.Get(name, options)
+	i.metrics.observeAPIRequest(i.bucket, "get", start, err)
+	return cfgMap, err
+}
+
+func (i *instrumentedImplementer) Create(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	start := time.Now()
+	created, err := i.ConfigMapInterface.Create(cfgMap)
+	i.metrics.observeAPIRequest(i.bucket, "create", start, err)
+	return created, err
+}
+
+func (i *instrumentedImplementer) Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	start := time.Now()
+	updated, err := i.ConfigMapInterface.Update(cfgMap)
+	i.metrics.observeAPIRequest(i.bucket, "update", start, err)
+	return updated, err
+}
+
+func (i *instrumentedImplementer) Delete(name string, options *meta_v1.DeleteOptions) error {
+	start := time.Now()
+	err := i.ConfigMapInterface.Delete(name, options)
+	i.metrics.observeAPIRequest(i.bucket, "delete", start, err)
+	return err
+}
+
+func (i *instrumentedImplementer) List(opts meta_v1.ListOptions) (*v1.ConfigMapList, error) {
+	start := time.Now()
+	list, err := i.ConfigMapInterface.List(opts)
+	i.metrics.observeAPIRequest(i.bucket, "list", start, err)
+	return list, err
+}
+
+func (i *instrumentedImplementer) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	start := time.Now()
+	w, err := i.ConfigMapInterface.Watch(opts)
+	i.metrics.observeAPIRequest(i.bucket, "watch", start, err)
+	return w, err
+}
@@ -0,0 +1,62 @@
+package kv
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatalf("failed to register metrics: %s", err)
+	}
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "b1", fmt.Errorf("modified"))
+	fi.updateErrs = []error{conflict}
+
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	kv.Get("foo")
+	kv.Get("missing")
+
+	if v := testutil.ToFloat64(metrics.operations.WithLabelValues("b1", "get")); v != 2 {
+		t.Errorf("expected 2 get operations, got: %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.operationErrors.WithLabelValues("b1", "get")); v != 0 {
+		t.Errorf("expected missing keys not to be counted as errors, got: %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.conflictRetries.WithLabelValues("b1")); v != 1 {
+		t.Errorf("expected 1 conflict retry, got: %v", v)
+	}
+	// get in New, 2 attempts of put and 2 gets
+	if v := testutil.ToFloat64(metrics.apiRequests.WithLabelValues("b1", "get", "success")); v != 5 {
+		t.Errorf("expected 5 get API requests, got: %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.apiRequests.WithLabelValues("b1", "update", "error")); v != 1 {
+		t.Errorf("expected 1 failed update API request, got: %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.bucketSize.WithLabelValues("b1")); v != float64(len(fi.getcfgMap.Data[dataKey])) {
+		t.Errorf("unexpected bucket size: %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.compressionRatio.WithLabelValues("b1")); v <= 0 {
+		t.Errorf("expected compression ratio to be set, got: %v", v)
+	}
+}
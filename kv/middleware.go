@@ -0,0 +1,120 @@
+package kv
+
+import (
+	"time"
+)
+
+// Middleware wraps KVDB to add behaviour (logging, metrics, validation...) around its operations.
+type Middleware func(next KVDB) KVDB
+
+// Chain wraps db with middlewares, first middleware is the outermost one.
+func Chain(db KVDB, middlewares ...Middleware) KVDB {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		db = middlewares[i](db)
+	}
+	return db
+}
+
+// Op names bucket operation, KVDB operations are passed to interceptors and all of them are used as metric labels.
+type Op string
+
+// operations
+const (
+	OpPut        Op = "put"
+	OpGet        Op = "get"
+	OpDelete     Op = "delete"
+	OpList       Op = "list"
+	OpTeardown   Op = "teardown"
+	OpPutMany    Op = "put_many"
+	OpIncr       Op = "incr"
+	OpDeleteTree Op = "delete_tree"
+	OpListDir    Op = "list_dir"
+	OpScan       Op = "scan"
+	OpKeys       Op = "keys"
+	OpIterate    Op = "iterate"
+	OpMigrate    Op = "migrate"
+	OpAdopt      Op = "adopt"
+	OpOrphan     Op = "orphan"
+	OpReplicate  Op = "replicate"
+	OpMerge      Op = "merge"
+	OpUndelete   Op = "undelete"
+	OpAudit      Op = "audit"
+)
+
+// Interceptor is called around every KVDB operation, it has to call next to execute the operation.
+// Key is the key of Put, Get and Delete operations, prefix of List and empty for Teardown.
+type Interceptor func(op Op, key string, next func() error) error
+
+// Intercept turns interceptor into Middleware.
+func Intercept(interceptor Interceptor) Middleware {
+	return func(next KVDB) KVDB {
+		return &interceptedKV{next: next, interceptor: interceptor}
+	}
+}
+
+type interceptedKV struct {
+	next        KVDB
+	interceptor Interceptor
+}
+
+func (i *interceptedKV) Put(key string, value []byte) error {
+	return i.interceptor(OpPut, key, func() error {
+		return i.next.Put(key, value)
+	})
+}
+
+func (i *interceptedKV) Get(key string) (value []byte, err error) {
+	err = i.interceptor(OpGet, key, func() error {
+		var err error
+		value, err = i.next.Get(key)
+		return err
+	})
+	return
+}
+
+func (i *interceptedKV) Delete(key string) error {
+	return i.interceptor(OpDelete, key, func() error {
+		return i.next.Delete(key)
+	})
+}
+
+func (i *interceptedKV) List(prefix string) (data map[string][]byte, err error) {
+	err = i.interceptor(OpList, prefix, func() error {
+		var err error
+		data, err = i.next.List(prefix)
+		return err
+	})
+	return
+}
+
+func (i *interceptedKV) Teardown() error {
+	return i.interceptor(OpTeardown, "", func() error {
+		return i.next.Teardown()
+	})
+}
+
+// Logger is implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Logging middleware logs every operation with its duration and error.
+func Logging(logger Logger) Middleware {
+	return Timing(func(op Op, key string, duration time.Duration, err error) {
+		if err != nil {
+			logger.Printf("k8s-kv: %s '%s' failed after %s: %s", op, key, duration, err)
+			return
+		}
+		logger.Printf("k8s-kv: %s '%s' took %s", op, key, duration)
+	})
+}
+
+// Timing middleware reports duration and result of every operation to observe func.
+func Timing(observe func(op Op, key string, duration time.Duration, err error)) Middleware {
+	return Intercept(func(op Op, key string, next func() error) error {
+		start := time.Now()
+		err := next()
+		observe(op, key, time.Since(start), err)
+		return err
+	})
+}
@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestChain(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	var calls []string
+	record := func(name string) Middleware {
+		return Intercept(func(op Op, key string, next func() error) error {
+			calls = append(calls, name+":"+string(op)+":"+key)
+			return next()
+		})
+	}
+	readOnly := Intercept(func(op Op, key string, next func() error) error {
+		if op == OpPut && strings.HasPrefix(key, "ro/") {
+			return errors.New("read only")
+		}
+		return next()
+	})
+
+	var buf bytes.Buffer
+	db := Chain(kv, record("outer"), record("inner"), readOnly, Logging(log.New(&buf, "", 0)))
+
+	err = db.Put("foo", []byte("bar"))
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	val, err := db.Get("foo")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if string(val) != "bar" {
+		t.Errorf("expected 'bar' but got: %s", string(val))
+	}
+
+	err = db.Put("ro/foo", []byte("bar"))
+	if err == nil {
+		t.Errorf("expected interceptor to reject put")
+	}
+
+	expected := []string{
+		"outer:put:foo", "inner:put:foo",
+		"outer:get:foo", "inner:get:foo",
+		"outer:put:ro/foo", "inner:put:ro/foo",
+	}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+
+	if !strings.Contains(buf.String(), "k8s-kv: get 'foo' took") {
+		t.Errorf("expected get to be logged, got: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "ro/foo") {
+		t.Errorf("expected rejected put not to reach logging middleware")
+	}
+}
+
+func TestTiming(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	var observed []Op
+	var lastErr error
+	db := Chain(kv, Timing(func(op Op, key string, duration time.Duration, err error) {
+		observed = append(observed, op)
+		lastErr = err
+	}))
+
+	db.List("")
+	db.Get("missing")
+
+	if len(observed) != 2 || observed[0] != OpList || observed[1] != OpGet {
+		t.Errorf("unexpected observed ops: %v", observed)
+	}
+	if lastErr != ErrNotFound {
+		t.Errorf("expected ErrNotFound to be observed, got: %v", lastErr)
+	}
+}
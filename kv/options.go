@@ -0,0 +1,114 @@
+package kv
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Option configures KV and DB instances.
+type Option func(*config)
+
+type config struct {
+	serializer      Serializer
+	conflictRetries int
+	cache           bool
+	validators      []validator
+	metrics         *Metrics
+	tracerProvider  trace.TracerProvider
+	auditSink       AuditSink
+	auditIdentity   string
+	eventRecorder   EventRecorder
+	autoRepair      bool
+	readOnly        bool
+	strict          bool
+	owners          []meta_v1.OwnerReference
+	labels          map[string]string
+	annotations     map[string]string
+	legacyLabels    bool
+	softDelete      time.Duration
+}
+
+// defaultConflictRetries is how many times a write is retried when config map was
+// modified by someone else between reading and updating it.
+const defaultConflictRetries = 3
+
+func defaultConfig() config {
+	return config{
+		serializer:      DefaultSerializer(),
+		conflictRetries: defaultConflictRetries,
+		tracerProvider:  trace.NewNoopTracerProvider(),
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithSerializer sets serializer used to encode bucket data.
+func WithSerializer(serializer Serializer) Option {
+	return func(c *config) {
+		c.serializer = serializer
+	}
+}
+
+// WithConflictRetries sets how many times Put and Delete operations are retried when config map
+// update fails because of a conflicting write. Set it to 0 to return conflict errors immediately.
+func WithConflictRetries(retries int) Option {
+	return func(c *config) {
+		c.conflictRetries = retries
+	}
+}
+
+// WithCache enables in-memory cache of bucket config maps. Cache is kept up to date by watching
+// config maps so reads don't hit API server. Background watchers are stopped by Close().
+func WithCache() Option {
+	return func(c *config) {
+		c.cache = true
+	}
+}
+
+// WithReadOnly makes bucket handles read-only: write operations return ErrReadOnly and missing buckets
+// are not created (operations return ErrBucketNotFound instead), so readers only need get, list and
+// watch permissions on config maps.
+func WithReadOnly() Option {
+	return func(c *config) {
+		c.readOnly = true
+	}
+}
+
+// WithStrict disables implicit creation of missing buckets. Buckets have to be created with CreateBucket
+// (or DB.CreateBucket), operations on missing buckets return ErrBucketNotFound.
+func WithStrict() Option {
+	return func(c *config) {
+		c.strict = true
+	}
+}
+
+// WithLabels adds labels to config maps created for buckets. Labels used by k8s-kv to identify
+// buckets can't be overridden.
+func WithLabels(labels map[string]string) Option {
+	return func(c *config) {
+		c.labels = labels
+	}
+}
+
+// WithAnnotations adds annotations to config maps created for buckets.
+func WithAnnotations(annotations map[string]string) Option {
+	return func(c *config) {
+		c.annotations = annotations
+	}
+}
+
+// WithLegacyLabels makes new buckets get BUCKET, APP and OWNER labels used by older versions (in addition to
+// app.kubernetes.io/* labels), so tools and apps that select buckets by them keep working.
+func WithLegacyLabels() Option {
+	return func(c *config) {
+		c.legacyLabels = true
+	}
+}
@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// WithOwner sets owner references of config maps created for buckets, Kubernetes garbage collector deletes
+// bucket once all of its owners are deleted. Owners have to be in the same namespace as the bucket, references
+// can be made with meta_v1.NewControllerRef:
+//
+//	kv.WithOwner(*meta_v1.NewControllerRef(deployment, apps_v1.SchemeGroupVersion.WithKind("Deployment")))
+//
+// Existing buckets are not changed, use KV.Adopt for them.
+func WithOwner(owners ...meta_v1.OwnerReference) Option {
+	return func(c *config) {
+		c.owners = owners
+	}
+}
+
+// Adopt adds owner reference to bucket's config map, reference with the same UID is replaced.
+func (k *KV) Adopt(owner meta_v1.OwnerReference) (err error) {
+	ctx, end := k.start(OpAdopt)
+	defer end(&err)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.updateMap(ctx, func(cfgMap *v1.ConfigMap) error {
+		cfgMap.OwnerReferences = append(withoutOwner(cfgMap.OwnerReferences, owner.UID), owner)
+		return nil
+	})
+}
+
+// Orphan removes owner reference with the UID from bucket's config map so bucket is no longer deleted
+// together with that owner.
+func (k *KV) Orphan(uid types.UID) (err error) {
+	ctx, end := k.start(OpOrphan)
+	defer end(&err)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.updateMap(ctx, func(cfgMap *v1.ConfigMap) error {
+		cfgMap.OwnerReferences = withoutOwner(cfgMap.OwnerReferences, uid)
+		return nil
+	})
+}
+
+// Owners returns owner references of bucket's config map.
+func (k *KV) Owners() ([]meta_v1.OwnerReference, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	cfgMap, err := k.getMap(k.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfgMap.OwnerReferences, nil
+}
+
+func withoutOwner(owners []meta_v1.OwnerReference, uid types.UID) []meta_v1.OwnerReference {
+	var result []meta_v1.OwnerReference
+	for _, owner := range owners {
+		if owner.UID != uid {
+			result = append(result, owner)
+		}
+	}
+	return result
+}
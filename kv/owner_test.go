@@ -0,0 +1,57 @@
+package kv
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestOwners(t *testing.T) {
+	deployment := &meta_v1.ObjectMeta{Name: "my-app", UID: "uid-1"}
+	ref := *meta_v1.NewControllerRef(deployment, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+
+	fi := &fakeImplementer{
+		getErr: apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "b1"),
+	}
+
+	kv, err := CreateBucket(fi, "app", "b1", WithOwner(ref))
+	if err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+	owners := fi.createdMap.OwnerReferences
+	if len(owners) != 1 || owners[0].UID != "uid-1" || owners[0].Kind != "Deployment" {
+		t.Fatalf("unexpected owners: %v", owners)
+	}
+
+	fi.getErr = nil
+	fi.getcfgMap = &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "b1"},
+		Data:       map[string]string{},
+	}
+
+	pod := meta_v1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "my-app-1", UID: "uid-2"}
+	if err := kv.Adopt(pod); err != nil {
+		t.Fatalf("failed to adopt: %s", err)
+	}
+	// adopting again replaces the reference
+	if err := kv.Adopt(pod); err != nil {
+		t.Fatalf("failed to adopt: %s", err)
+	}
+	if len(fi.updatedMap.OwnerReferences) != 1 || fi.updatedMap.OwnerReferences[0].UID != "uid-2" {
+		t.Errorf("unexpected owners: %v", fi.updatedMap.OwnerReferences)
+	}
+
+	if err := kv.Orphan("uid-2"); err != nil {
+		t.Fatalf("failed to orphan: %s", err)
+	}
+	owners, err = kv.Owners()
+	if err != nil {
+		t.Fatalf("failed to get owners: %s", err)
+	}
+	if len(owners) != 0 {
+		t.Errorf("expected no owners, got: %v", owners)
+	}
+}
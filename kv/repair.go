@@ -0,0 +1,228 @@
+package kv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrCorrupted matches any *CorruptedError with errors.Is
+var ErrCorrupted = errors.New("bucket data is corrupted")
+
+// CorruptedError is returned when bucket data can't be decoded, ie: config map was edited by hand
+// or a partial write landed.
+type CorruptedError struct {
+	Bucket string
+	// Stage that failed: checksum, base64, gzip or decode
+	Stage string
+	Err   error
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("bucket '%s' data is corrupted (%s): %s", e.Bucket, e.Stage, e.Err)
+}
+
+// Is makes errors.Is(err, ErrCorrupted) work.
+func (e *CorruptedError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// IsCorrupted returns true if err is (or wraps) *CorruptedError.
+func IsCorrupted(err error) bool {
+	var cerr *CorruptedError
+	return errors.As(err, &cerr)
+}
+
+// WithAutoRepair makes operations repair corrupted buckets (see KV.Repair) instead of failing with *CorruptedError.
+func WithAutoRepair() Option {
+	return func(c *config) {
+		c.autoRepair = true
+	}
+}
+
+// RepairReport describes result of KV.Repair.
+type RepairReport struct {
+	// Corrupted is false if bucket was healthy and nothing was done
+	Corrupted bool
+	// Cause is the error bucket data failed with
+	Cause *CorruptedError
+	// Recovered is the number of entries salvaged from corrupted data
+	Recovered int
+	// Quarantine is the name of config map that holds a copy of corrupted data
+	Quarantine string
+}
+
+// Repair checks whether bucket data can be decoded and if it can't - copies corrupted config map to
+// a quarantine config map, salvages entries that can still be decoded and saves them as the new bucket data.
+// Entries added to config map by hand (keys other than k8s-kv's own) are salvaged as well.
+func (k *KV) Repair() (report RepairReport, err error) {
+	if k.readOnly {
+		return report, ErrReadOnly
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	cfgMap, err := k.getMap(k.ctx)
+	if err != nil {
+		return report, err
+	}
+
+	_, err = decodeConfigMap(k.serializer, cfgMap)
+	if err == nil {
+		return report, nil
+	}
+	cerr, ok := err.(*CorruptedError)
+	if !ok {
+		return report, err
+	}
+	cerr.Bucket = k.bucket
+
+	report.Corrupted = true
+	report.Cause = cerr
+
+	var im map[string][]byte
+	report.Quarantine, im, err = k.repair(k.ctx, cfgMap)
+	report.Recovered = len(im)
+	return report, err
+}
+
+// repairCorrupted repairs bucket after getInternalMap found it corrupted (see WithAutoRepair). Conflicts
+// are returned as they are so the whole operation, repair included, is retried.
+func (k *KV) repairCorrupted(ctx context.Context, cfgMap *v1.ConfigMap, cerr *CorruptedError) (*v1.ConfigMap, map[string][]byte, error) {
+	_, im, err := k.repair(ctx, cfgMap)
+	if apierrors.IsConflict(err) {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, repair failed: %w", cerr, err)
+	}
+
+	// getting updated resource version for the caller
+	cfgMap, err = k.getMap(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfgMap, im, nil
+}
+
+// repair quarantines corrupted config map and replaces its data with salvaged entries.
+func (k *KV) repair(ctx context.Context, cfgMap *v1.ConfigMap) (quarantine string, im map[string][]byte, err error) {
+	quarantine, err = k.quarantine(cfgMap)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to quarantine corrupted data: %w", err)
+	}
+
+	im = salvage(k.serializer, cfgMap)
+
+	// hand-added keys are now part of the bucket data
+	for key := range cfgMap.Data {
+		delete(cfgMap.Data, key)
+	}
+	if err := k.saveInternalMap(ctx, cfgMap, im); err != nil {
+		return quarantine, nil, err
+	}
+
+	k.event(cfgMap, v1.EventTypeWarning, ReasonBucketRepaired, "corrupted bucket was repaired, %d entries recovered, corrupted data saved to '%s'",
+		len(im), quarantine)
+	return quarantine, im, nil
+}
+
+// quarantine copies config map into a new config map and returns its name. Copy is named after a hash of
+// the data so retried repairs of the same data reuse it.
+func (k *KV) quarantine(cfgMap *v1.ConfigMap) (string, error) {
+	// different manager so quarantined data doesn't show up as a bucket
+	lbs := k.bucketLabels(managedByQuarantine)
+
+	backup := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:   suffixedName(k.bucket, "-quarantine-"+dataHash(cfgMap)),
+			Labels: lbs.toMap(),
+		},
+		Data:       make(map[string]string, len(cfgMap.Data)),
+		BinaryData: cfgMap.BinaryData,
+	}
+	for key, val := range cfgMap.Data {
+		backup.Data[key] = val
+	}
+
+	created, err := k.implementer.Create(backup)
+	if apierrors.IsAlreadyExists(err) {
+		return backup.Name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
+
+// dataHash returns a short hash of config map's data.
+func dataHash(cfgMap *v1.ConfigMap) string {
+	// map keys are sorted by json encoder
+	b, _ := json.Marshal([]interface{}{cfgMap.Data, cfgMap.BinaryData})
+	return valueHash(b)
+}
+
+// salvage decodes as much of the config map as it can.
+func salvage(serializer Serializer, cfgMap *v1.ConfigMap) map[string][]byte {
+	im := salvageData(serializer, cfgMap.Data[dataKey])
+	if im == nil {
+		im = make(map[string][]byte)
+	}
+
+	for key, val := range cfgMap.Data {
+		if key == dataKey {
+			continue
+		}
+		if _, ok := im[key]; !ok {
+			im[key] = []byte(val)
+		}
+	}
+	return im
+}
+
+func salvageData(serializer Serializer, data string) map[string][]byte {
+	// checksum mismatch only, data is fine
+	if im, err := decodeInternalMap(serializer, data); err == nil {
+		return im
+	}
+
+	b, err := b64.DecodeString(data)
+	if cerr, ok := err.(base64.CorruptInputError); ok {
+		// decode up to the corrupted part
+		b, _ = b64.DecodeString(data[:int(cerr)/4*4])
+	}
+
+	// checksum is ignored, whatever decodes is better than nothing
+	h, payload := parseHeader(b)
+	serializer, err = serializerFor(h.serializer, serializer)
+	if err != nil {
+		return nil
+	}
+	if h.codec == codecGzip {
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil
+		}
+		// whatever was decompressed before the error
+		payload, _ = ioutil.ReadAll(r)
+	}
+
+	var im internalMap
+	serializer.Decode(payload, &im)
+	return im.Data
+}
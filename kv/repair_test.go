@@ -0,0 +1,190 @@
+package kv
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestChecksumMismatch(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	encoded := fi.getcfgMap.Data[dataKey]
+
+	// payload modified without updating the checksum in its header
+	b, _ := b64.DecodeString(encoded)
+	b[len(b)-1] ^= 0xff
+	fi.getcfgMap.Data[dataKey] = b64.EncodeToString(b)
+	_, err = kv.Get("foo")
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected corrupted error, got: %v", err)
+	}
+	cerr := err.(*CorruptedError)
+	if cerr.Bucket != "b1" || cerr.Stage != "checksum" {
+		t.Errorf("unexpected error: %#v", cerr)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	report, err := kv.Repair()
+	if err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+	if report.Corrupted {
+		t.Errorf("healthy bucket reported as corrupted")
+	}
+
+	kv.Put("foo", []byte("bar"))
+	encoded := fi.getcfgMap.Data[dataKey]
+	// truncated write and a hand-edited key
+	fi.getcfgMap.Data[dataKey] = encoded[:len(encoded)-3] + "!!!"
+	fi.getcfgMap.Data["manual"] = "edit"
+
+	_, err = kv.Get("foo")
+	if !IsCorrupted(err) {
+		t.Fatalf("expected corrupted error, got: %v", err)
+	}
+
+	report, err = kv.Repair()
+	if err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+	if !report.Corrupted || report.Cause == nil {
+		t.Errorf("expected bucket to be corrupted")
+	}
+
+	quarantined := fi.createdMap
+	if quarantined.Name != report.Quarantine || quarantined.Labels[labelManagedBy] != managedByQuarantine {
+		t.Errorf("unexpected quarantine config map: %s %v", quarantined.Name, quarantined.Labels)
+	}
+	if quarantined.Data[dataKey] != encoded[:len(encoded)-3]+"!!!" {
+		t.Errorf("corrupted data wasn't copied to quarantine")
+	}
+
+	val, err := kv.Get("manual")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if string(val) != "edit" {
+		t.Errorf("unexpected value: %s", val)
+	}
+	if _, ok := fi.getcfgMap.Data["manual"]; ok {
+		t.Errorf("hand-added key should be moved into bucket data")
+	}
+}
+
+func TestAutoRepair(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithAutoRepair())
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	fi.getcfgMap.Data[dataKey] = "garbage"
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if fi.createdMap == nil || fi.createdMap.Data[dataKey] != "garbage" {
+		t.Errorf("expected corrupted data to be quarantined")
+	}
+
+	val, err := kv.Get("foo")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if string(val) != "bar" {
+		t.Errorf("unexpected value: %s", val)
+	}
+}
+
+func TestAutoRepairConcurrentReads(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	kv, err := New(impl, "app", "b1", WithAutoRepair())
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	cfgMap, _ := impl.Get("b1", meta_v1.GetOptions{})
+	cfgMap.Data[dataKey] = "garbage"
+	cfgMap.Data["manual"] = "edit"
+	if _, err := impl.Update(cfgMap); err != nil {
+		t.Fatalf("failed to corrupt bucket: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := kv.Get("manual")
+			if err != nil || string(val) != "edit" {
+				t.Errorf("expected repaired value, got: %s, %v", val, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	quarantined, err := impl.List(meta_v1.ListOptions{LabelSelector: labelManagedBy + "=" + managedByQuarantine})
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(quarantined.Items) != 1 {
+		t.Errorf("expected bucket to be repaired once, got %d quarantined copies", len(quarantined.Items))
+	}
+}
+
+func TestAutoRepairConflict(t *testing.T) {
+	impl := newFakeAPIServer()
+	kv, err := New(impl, "app", "b1", WithAutoRepair())
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	cfgMap, _ := impl.Get("b1", meta_v1.GetOptions{})
+	cfgMap.Data[dataKey] = "garbage"
+	cfgMap.Data["manual"] = "edit"
+	impl.Update(cfgMap)
+
+	// saving repaired data conflicts with another writer
+	impl.conflicts = 1
+	if err := kv.Put("foo", []byte("bar")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if val, err := kv.Get("manual"); err != nil || string(val) != "edit" {
+		t.Errorf("expected repaired value, got: %s, %v", val, err)
+	}
+
+	quarantined, _ := impl.List(meta_v1.ListOptions{LabelSelector: labelManagedBy + "=" + managedByQuarantine})
+	if len(quarantined.Items) != 1 {
+		t.Errorf("expected a single quarantined copy, got %d", len(quarantined.Items))
+	}
+}
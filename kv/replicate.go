@@ -0,0 +1,446 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Replicate mirrors src bucket into dst bucket: dst gets all of src's entries and loses keys that src
+// doesn't have. Buckets can be in different namespaces or clusters (see Namespaced), dst is written
+// with a single config map update.
+func Replicate(src, dst *KV) error {
+	return NewReplicator(src, []*KV{dst}).Sync()
+}
+
+// ConflictPolicy decides what Replicator does with destination entries that were changed by someone else.
+type ConflictPolicy int
+
+const (
+	// SourceWins overwrites destination entries with source values
+	SourceWins ConflictPolicy = iota
+	// SkipConflicts leaves destination entries that were changed since they were last replicated (or that
+	// had a different value before replication started) alone. Hashes of replicated values are kept in destination's
+	// annotation so conflicts are detected across restarts and by other replicators.
+	SkipConflicts
+)
+
+// annotationReplicated holds JSON encoded hashes of values replicated to the bucket, see SkipConflicts
+const annotationReplicated = "k8s-kv/replicated"
+
+// maxAnnotationsSize is the limit of total size of config map's annotations
+const maxAnnotationsSize = 256 * 1024
+
+// ErrReplicatedHashesTooLarge is returned when hashes of values replicated with SkipConflicts policy don't
+// fit into destination's annotations (about 5000 keys, depending on key length). Replicate fewer keys (see
+// WithPrefixes) or use SourceWins policy.
+var ErrReplicatedHashesTooLarge = errors.New("hashes of replicated values exceed config map annotations size limit")
+
+// defaultResyncInterval is how often Replicator re-reads the whole source bucket in case watch events were missed
+const defaultResyncInterval = 5 * time.Minute
+
+// ReplicatorOption configures Replicator.
+type ReplicatorOption func(*Replicator)
+
+// WithPrefixes limits replication to keys with any of the prefixes, keys outside of them are not touched
+// in destination buckets.
+func WithPrefixes(prefixes ...string) ReplicatorOption {
+	return func(r *Replicator) {
+		r.prefixes = prefixes
+	}
+}
+
+// WithConflictPolicy sets conflict policy, default is SourceWins.
+func WithConflictPolicy(policy ConflictPolicy) ReplicatorOption {
+	return func(r *Replicator) {
+		r.policy = policy
+	}
+}
+
+// WithResyncInterval sets how often whole source bucket is replicated regardless of watch events.
+func WithResyncInterval(interval time.Duration) ReplicatorOption {
+	return func(r *Replicator) {
+		r.resyncInterval = interval
+	}
+}
+
+// ReplicationStatus describes state of replication to a destination bucket.
+type ReplicationStatus struct {
+	Bucket string
+	// LastSync is when destination last caught up with the source
+	LastSync time.Time
+	// Lag is how long destination has been behind the source: since a source change was observed until
+	// it's applied, zero when it's up to date
+	Lag time.Duration
+	// Applied is the number of key changes written to destination
+	Applied int
+	// Skipped is the number of conflicting entries left alone by the last sync because of SkipConflicts policy
+	Skipped int
+	// Errors is the number of failed syncs, LastError is the error of the last one (nil if it succeeded)
+	Errors    int
+	LastError error
+}
+
+// Replicator keeps destination buckets in sync with a source bucket. It watches source's config map and
+// applies key level differences to destinations, so destinations may have extra keys outside of the
+// replicated prefixes. Deleting source bucket doesn't delete replicated data.
+type Replicator struct {
+	src            *KV
+	dsts           []*KV
+	prefixes       []string
+	policy         ConflictPolicy
+	resyncInterval time.Duration
+
+	// syncMu serializes syncs
+	syncMu sync.Mutex
+
+	mu     sync.Mutex
+	status []ReplicationStatus
+	// pending is when destination fell behind the source
+	pending []time.Time
+}
+
+// NewReplicator creates a replicator of src bucket into dsts buckets.
+func NewReplicator(src *KV, dsts []*KV, opts ...ReplicatorOption) *Replicator {
+	r := &Replicator{
+		src:            src,
+		dsts:           dsts,
+		policy:         SourceWins,
+		resyncInterval: defaultResyncInterval,
+		status:         make([]ReplicationStatus, len(dsts)),
+		pending:        make([]time.Time, len(dsts)),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	for i, dst := range dsts {
+		r.status[i].Bucket = dst.bucket
+	}
+	return r
+}
+
+// Status returns replication status of each destination, in the order destinations were given.
+func (r *Replicator) Status() []ReplicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := make([]ReplicationStatus, len(r.status))
+	copy(status, r.status)
+	for i := range status {
+		if !r.pending[i].IsZero() {
+			status[i].Lag = time.Since(r.pending[i])
+		}
+	}
+	return status
+}
+
+// Sync reads the whole source bucket and replicates it to all destinations. Error of the first failed
+// destination is returned, other destinations are still synced. Missing source bucket is never created,
+// ErrBucketNotFound is returned and destinations are left as they are.
+func (r *Replicator) Sync() error {
+	observed := time.Now()
+	data, err := r.readSource()
+	if err != nil {
+		r.fail(-1, err, observed)
+		return err
+	}
+	return r.apply(data, observed)
+}
+
+// readSource reads source bucket's config map directly: reading it through KV would create an empty
+// bucket once the source is deleted and its emptiness would be replicated.
+func (r *Replicator) readSource() (map[string][]byte, error) {
+	cfgMap, err := r.src.implementer.Get(r.src.bucket, meta_v1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return decodeConfigMap(r.src.serializer, cfgMap)
+}
+
+// Run replicates source bucket until ctx is cancelled. Source config map is watched for changes and
+// replicated in full every resync interval in case watch events were missed.
+func (r *Replicator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.resyncInterval)
+	defer ticker.Stop()
+
+	for {
+		r.Sync()
+
+		w, err := r.src.implementer.Watch(meta_v1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", r.src.bucket).String(),
+		})
+		if err == nil {
+			err = r.consume(ctx, w, ticker.C)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// consume replicates source changes until watch is closed or ctx is cancelled.
+func (r *Replicator) consume(ctx context.Context, w watch.Interface, resync <-chan time.Time) error {
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resync:
+			r.Sync()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				cfgMap, ok := event.Object.(*v1.ConfigMap)
+				if !ok {
+					continue
+				}
+				data, err := decodeConfigMap(r.src.serializer, cfgMap)
+				if err != nil {
+					r.fail(-1, err, time.Now())
+					continue
+				}
+				r.apply(data, time.Now())
+			case watch.Error:
+				return nil
+			}
+		}
+	}
+}
+
+func (r *Replicator) replicates(key string) bool {
+	if len(r.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Replicator) apply(data map[string][]byte, observed time.Time) error {
+	r.behind(observed)
+
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	var firstErr error
+	for i, dst := range r.dsts {
+		applied, skipped, err := r.applyTo(dst, data)
+		if err != nil {
+			r.fail(i, err, observed)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		r.mu.Lock()
+		r.status[i].LastSync = time.Now()
+		r.status[i].Applied += applied
+		r.status[i].Skipped = skipped
+		r.status[i].LastError = nil
+		r.pending[i] = time.Time{}
+		r.mu.Unlock()
+	}
+	return firstErr
+}
+
+// behind marks destinations as behind the source since source state was observed, unless they already are.
+func (r *Replicator) behind(observed time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.pending {
+		if r.pending[i].IsZero() {
+			r.pending[i] = observed
+		}
+	}
+}
+
+// fail records failed sync of destination i, -1 means all destinations.
+func (r *Replicator) fail(i int, err error, observed time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for j := range r.status {
+		if i >= 0 && i != j {
+			continue
+		}
+		r.status[j].Errors++
+		r.status[j].LastError = err
+		if r.pending[j].IsZero() {
+			r.pending[j] = observed
+		}
+	}
+}
+
+// applyTo writes differences between data and destination.
+func (r *Replicator) applyTo(dst *KV, data map[string][]byte) (applied, skipped int, err error) {
+	ctx, end := dst.start(OpReplicate)
+	defer end(&err)
+
+	// replicated values and deletes (nil values) for the audit
+	var changes map[string][]byte
+
+	dst.mu.Lock()
+	err = dst.retryConflicts(func() error {
+		applied, skipped = 0, 0
+		changes = make(map[string][]byte)
+		// recorded is true if hashes of values destination already had were added
+		recorded := false
+
+		cfgMap, im, err := dst.getInternalMap(ctx)
+		if err != nil {
+			return err
+		}
+		replicated, err := replicatedHashes(cfgMap)
+		if err != nil {
+			return err
+		}
+
+		for key, value := range data {
+			if !r.replicates(key) {
+				continue
+			}
+			current, ok := im[key]
+			if ok && bytes.Equal(current, value) {
+				// destination already has the value (ie: it was seeded with Copy), it's replicated from now on
+				if hash := valueHash(value); replicated[key] != hash {
+					replicated[key] = hash
+					recorded = true
+				}
+				continue
+			}
+			if ok && r.conflicts(replicated, key, current) {
+				skipped++
+				continue
+			}
+			// same as PutMany, nothing is written if any of the values is rejected
+			if err := dst.validate(key, value); err != nil {
+				return err
+			}
+			im[key] = value
+			replicated[key] = valueHash(value)
+			changes[key] = value
+		}
+
+		for key, current := range im {
+			if _, ok := data[key]; ok || !r.replicates(key) {
+				continue
+			}
+			if r.conflicts(replicated, key, current) {
+				skipped++
+				continue
+			}
+			delete(im, key)
+			delete(replicated, key)
+			changes[key] = nil
+		}
+
+		applied = len(changes)
+		if applied == 0 && (!recorded || r.policy != SkipConflicts) {
+			return nil
+		}
+
+		if r.policy == SkipConflicts {
+			// entries deleted by someone else
+			for key := range replicated {
+				if _, ok := im[key]; !ok {
+					delete(replicated, key)
+				}
+			}
+			if err := setReplicatedHashes(cfgMap, replicated); err != nil {
+				return err
+			}
+		}
+		return dst.saveInternalMap(ctx, cfgMap, im)
+	})
+	dst.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dst.auditMany(OpReplicate, changes)
+	return applied, skipped, nil
+}
+
+// conflicts returns true if destination entry was changed by someone else and shouldn't be overwritten.
+func (r *Replicator) conflicts(replicated map[string]string, key string, current []byte) bool {
+	if r.policy == SourceWins {
+		return false
+	}
+	last, ok := replicated[key]
+	return !ok || last != valueHash(current)
+}
+
+// valueHash returns a short hash of the value, it only has to tell values written by replicator apart
+// from values changed by someone else.
+func valueHash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:8])
+}
+
+// replicatedHashes returns hashes of values last replicated to the bucket.
+func replicatedHashes(cfgMap *v1.ConfigMap) (map[string]string, error) {
+	hashes := make(map[string]string)
+	encoded, ok := cfgMap.Annotations[annotationReplicated]
+	if !ok {
+		return hashes, nil
+	}
+	if err := json.Unmarshal([]byte(encoded), &hashes); err != nil {
+		return nil, fmt.Errorf("failed to decode '%s' annotation: %s", annotationReplicated, err)
+	}
+	return hashes, nil
+}
+
+func setReplicatedHashes(cfgMap *v1.ConfigMap, hashes map[string]string) error {
+	encoded, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+
+	annotations := make(map[string]string, len(cfgMap.Annotations)+1)
+	for key, val := range cfgMap.Annotations {
+		annotations[key] = val
+	}
+	annotations[annotationReplicated] = string(encoded)
+
+	size := 0
+	for key, val := range annotations {
+		size += len(key) + len(val)
+	}
+	if size > maxAnnotationsSize {
+		return ErrReplicatedHashesTooLarge
+	}
+
+	cfgMap.Annotations = annotations
+	return nil
+}
@@ -0,0 +1,389 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func clusterGetter(cluster *fake.Clientset) ConfigMapsGetter {
+	return ConfigMapsGetterFunc(func(namespace string) ConfigMapInterface {
+		return cluster.CoreV1().ConfigMaps(namespace)
+	})
+}
+
+func TestNamespacedDB(t *testing.T) {
+	db, err := Namespaced(clusterGetter(fake.NewSimpleClientset()), "default", "app")
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+
+	local, err := db.Bucket("b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+	other, err := db.BucketIn("other", "b1")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+	if local == other {
+		t.Fatalf("expected different handles for different namespaces")
+	}
+
+	local.Put("foo", []byte("local"))
+	other.Put("foo", []byte("other"))
+
+	val, err := local.Get("foo")
+	if err != nil || string(val) != "local" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+
+	buckets, err := db.BucketsIn("other")
+	if err != nil {
+		t.Fatalf("failed to list buckets: %s", err)
+	}
+	if len(buckets) != 1 || buckets[0].Keys != 1 {
+		t.Errorf("unexpected buckets: %+v", buckets)
+	}
+
+	single, _ := Open(&fakeImplementer{}, "app")
+	if _, err := single.BucketIn("other", "b1"); err != ErrSingleNamespace {
+		t.Errorf("expected single namespace error, got: %v", err)
+	}
+}
+
+func TestNamespacedDBOwners(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	owner := meta_v1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "my-app", UID: "123"}
+	db, err := Namespaced(clusterGetter(cluster), "default", "app", WithOwner(owner))
+	if err != nil {
+		t.Fatalf("failed to open db: %s", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Bucket("b1"); err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+	if _, err := db.BucketIn("other", "b1"); err != nil {
+		t.Fatalf("failed to get bucket: %s", err)
+	}
+
+	local, _ := cluster.CoreV1().ConfigMaps("default").Get("b1", meta_v1.GetOptions{})
+	if len(local.OwnerReferences) != 1 || local.OwnerReferences[0].UID != owner.UID {
+		t.Errorf("expected bucket to be owned, got: %v", local.OwnerReferences)
+	}
+	other, _ := cluster.CoreV1().ConfigMaps("other").Get("b1", meta_v1.GetOptions{})
+	if len(other.OwnerReferences) != 0 {
+		t.Errorf("expected bucket in other namespace not to be owned, got: %v", other.OwnerReferences)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	primary := fake.NewSimpleClientset()
+	standby := fake.NewSimpleClientset()
+
+	src, err := New(primary.CoreV1().ConfigMaps("default"), "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	dst, err := New(standby.CoreV1().ConfigMaps("dr"), "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	src.Put("a", []byte("a-val"))
+	src.Put("b", []byte("b-val"))
+	dst.Put("stale", []byte("x"))
+
+	if err := Replicate(src, dst); err != nil {
+		t.Fatalf("failed to replicate: %s", err)
+	}
+
+	data, err := dst.List("")
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(data) != 2 || string(data["a"]) != "a-val" || string(data["b"]) != "b-val" {
+		t.Errorf("unexpected replicated data: %v", data)
+	}
+}
+
+func TestReplicator(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	team1, _ := New(getter.ConfigMaps("team1"), "app", "settings")
+	team2, _ := New(getter.ConfigMaps("team2"), "app", "settings")
+
+	src.Put("public/a", []byte("1"))
+	src.Put("public/b", []byte("2"))
+	src.Put("secret/c", []byte("3"))
+	team2.Put("public/a", []byte("local"))
+	team2.Put("own", []byte("x"))
+
+	r := NewReplicator(src, []*KV{team1, team2}, WithPrefixes("public/"), WithConflictPolicy(SkipConflicts))
+
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	data, _ := team1.List("")
+	if len(data) != 2 || string(data["public/a"]) != "1" || string(data["public/b"]) != "2" {
+		t.Errorf("unexpected team1 data: %v", data)
+	}
+	// pre-existing value is a conflict, keys outside of prefixes are not touched
+	data, _ = team2.List("")
+	if len(data) != 3 || string(data["public/a"]) != "local" || string(data["own"]) != "x" {
+		t.Errorf("unexpected team2 data: %v", data)
+	}
+
+	status := r.Status()
+	if status[0].Bucket != "settings" || status[0].Applied != 2 || status[0].LastError != nil {
+		t.Errorf("unexpected team1 status: %+v", status[0])
+	}
+	if status[1].Applied != 1 || status[1].Skipped != 1 {
+		t.Errorf("unexpected team2 status: %+v", status[1])
+	}
+
+	src.Delete("public/b")
+	src.Put("public/a", []byte("new"))
+	team1.Put("public/a", []byte("edited"))
+
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	data, _ = team1.List("")
+	if len(data) != 1 || string(data["public/a"]) != "edited" {
+		t.Errorf("unexpected team1 data: %v", data)
+	}
+	if _, ok := data["public/b"]; ok {
+		t.Errorf("deleted key wasn't replicated")
+	}
+}
+
+func TestReplicatorDeletedSource(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings")
+
+	src.Put("foo", []byte("bar"))
+	r := NewReplicator(src, []*KV{dst})
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	if err := cluster.CoreV1().ConfigMaps("config").Delete("settings", &meta_v1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete source: %s", err)
+	}
+
+	if err := r.Sync(); err != ErrBucketNotFound {
+		t.Errorf("expected ErrBucketNotFound, got: %v", err)
+	}
+	if _, err := cluster.CoreV1().ConfigMaps("config").Get("settings", meta_v1.GetOptions{}); err == nil {
+		t.Errorf("source bucket shouldn't be recreated")
+	}
+
+	data, _ := dst.List("")
+	if len(data) != 1 || string(data["foo"]) != "bar" {
+		t.Errorf("expected replicated data to be kept, got: %v", data)
+	}
+	if status := r.Status(); status[0].Errors != 1 || status[0].LastError != ErrBucketNotFound {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+}
+
+func TestReplicatorValidators(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings", WithValidator("", func(key string, value []byte) error {
+		if string(value) == "invalid" {
+			return fmt.Errorf("rejected")
+		}
+		return nil
+	}))
+
+	src.Put("a", []byte("valid"))
+	src.Put("b", []byte("invalid"))
+
+	r := NewReplicator(src, []*KV{dst})
+	err := r.Sync()
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+
+	data, _ := dst.List("")
+	if len(data) != 0 {
+		t.Errorf("expected nothing to be replicated, got: %v", data)
+	}
+}
+
+func TestReplicatorSkipConflictsRestart(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings")
+
+	src.Put("a", []byte("1"))
+	src.Put("b", []byte("2"))
+	if err := NewReplicator(src, []*KV{dst}, WithConflictPolicy(SkipConflicts)).Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	src.Put("a", []byte("new"))
+	src.Put("b", []byte("new"))
+	dst.Put("b", []byte("edited"))
+
+	// new replicator knows what was replicated before
+	r := NewReplicator(src, []*KV{dst}, WithConflictPolicy(SkipConflicts))
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	data, _ := dst.List("")
+	if string(data["a"]) != "new" || string(data["b"]) != "edited" {
+		t.Errorf("unexpected replicated data: %v", data)
+	}
+	if status := r.Status(); status[0].Applied != 1 || status[0].Skipped != 1 {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+}
+
+func TestReplicatorCopySeeded(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	db, _ := Open(impl, "app")
+	defer db.Close()
+
+	src, _ := db.Bucket("src")
+	src.Put("k", []byte("v1"))
+	if err := db.Copy("src", "dst"); err != nil {
+		t.Fatalf("failed to copy: %s", err)
+	}
+	dst, _ := db.Bucket("dst")
+
+	r := NewReplicator(src, []*KV{dst}, WithConflictPolicy(SkipConflicts))
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+	src.Put("k", []byte("v2"))
+	if err := r.Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+
+	if val, _ := dst.Get("k"); string(val) != "v2" {
+		t.Errorf("expected change to be replicated, got: %s", val)
+	}
+	if status := r.Status(); status[0].Applied != 1 || status[0].Skipped != 0 {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+}
+
+func TestReplicatorHashesTooLarge(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings")
+
+	data := make(map[string][]byte)
+	for i := 0; i < 1000; i++ {
+		data[fmt.Sprintf("%s-%d", strings.Repeat("k", 250), i)] = []byte("v")
+	}
+	if err := src.PutMany(data); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	r := NewReplicator(src, []*KV{dst}, WithConflictPolicy(SkipConflicts))
+	if err := r.Sync(); err != ErrReplicatedHashesTooLarge {
+		t.Fatalf("expected hashes too large error, got: %v", err)
+	}
+	if keys, _ := dst.Keys(""); len(keys) != 0 {
+		t.Errorf("expected nothing to be replicated, got %d keys", len(keys))
+	}
+
+	// hashes are only kept with SkipConflicts
+	if err := NewReplicator(src, []*KV{dst}).Sync(); err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+}
+
+func TestReplicatorLag(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	applying := make(chan struct{})
+	release := make(chan struct{})
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings", WithValidator("", func(key string, value []byte) error {
+		close(applying)
+		<-release
+		return nil
+	}))
+
+	src.Put("foo", []byte("bar"))
+	r := NewReplicator(src, []*KV{dst})
+
+	done := make(chan error)
+	go func() { done <- r.Sync() }()
+
+	<-applying
+	time.Sleep(10 * time.Millisecond)
+	if lag := r.Status()[0].Lag; lag <= 0 {
+		t.Errorf("expected destination to be behind while change is applied, got lag: %s", lag)
+	}
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+	if lag := r.Status()[0].Lag; lag != 0 {
+		t.Errorf("expected no lag once change is applied, got: %s", lag)
+	}
+}
+
+func TestReplicatorRun(t *testing.T) {
+	cluster := fake.NewSimpleClientset()
+	getter := clusterGetter(cluster)
+
+	src, _ := New(getter.ConfigMaps("config"), "app", "settings")
+	dst, _ := New(getter.ConfigMaps("replica"), "app", "settings")
+
+	r := NewReplicator(src, []*KV{dst})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// puts until watch is established
+		src.Put("foo", []byte("bar"))
+		val, err := dst.Get("foo")
+		if err == nil && string(val) == "bar" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("change wasn't replicated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context canceled error, got: %v", err)
+	}
+	if status := r.Status(); status[0].Lag != 0 || status[0].LastSync.IsZero() {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+}
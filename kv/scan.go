@@ -0,0 +1,122 @@
+package kv
+
+import (
+	"sort"
+	"strings"
+)
+
+// Entry is a single key/value pair returned by Scan.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Scan returns entries with keys in range [start, end) sorted by key. Empty end means that range has
+// no upper bound and limit <= 0 means no limit. When there are more entries in range than the limit,
+// next is set to the key that should be used as start to continue scanning, otherwise it's empty.
+func (k *KV) Scan(start, end string, limit int) (entries []Entry, next string, err error) {
+	ctx, endOp := k.start(OpScan)
+	defer endOp(&err)
+
+	im, err := k.readInternalMap(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, key := range sortedKeys(im, "") {
+		if key < start {
+			continue
+		}
+		if end != "" && key >= end {
+			break
+		}
+		if limit > 0 && len(entries) == limit {
+			return entries, key, nil
+		}
+		entries = append(entries, Entry{Key: key, Value: im[key]})
+	}
+	return entries, "", nil
+}
+
+// Keys returns sorted names of all keys that match specific prefix.
+func (k *KV) Keys(prefix string) (keys []string, err error) {
+	ctx, end := k.start(OpKeys)
+	defer end(&err)
+
+	im, err := k.readInternalMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(im, prefix), nil
+}
+
+// Iterate returns an iterator over entries that match specific prefix in key order. Bucket is read once
+// when iterator is created, values are returned one at a time instead of being copied into a result map.
+func (k *KV) Iterate(prefix string) *Iterator {
+	var err error
+	ctx, end := k.start(OpIterate)
+	defer end(&err)
+
+	im, err := k.readInternalMap(ctx)
+	if err != nil {
+		return &Iterator{err: err}
+	}
+
+	return &Iterator{
+		im:   im,
+		keys: sortedKeys(im, prefix),
+		pos:  -1,
+	}
+}
+
+// Iterator iterates over bucket entries, use it like:
+//
+//	it := kvdb.Iterate("prefix")
+//	for it.Next() {
+//		fmt.Println(it.Key(), string(it.Value()))
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	im   map[string][]byte
+	keys []string
+	pos  int
+	err  error
+}
+
+// Next advances iterator to the next entry, it returns false when there are no more entries or an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.pos+1 >= len(it.keys) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// Key returns key of the current entry.
+func (it *Iterator) Key() string {
+	return it.keys[it.pos]
+}
+
+// Value returns value of the current entry.
+func (it *Iterator) Value() []byte {
+	return it.im[it.keys[it.pos]]
+}
+
+// Err returns error that occurred while reading the bucket.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func sortedKeys(im map[string][]byte, prefix string) []string {
+	keys := make([]string, 0, len(im))
+	for key := range im {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func newScanTestKV(t *testing.T, count int) *KV {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	data := make(map[string][]byte)
+	for i := 0; i < count; i++ {
+		data[fmt.Sprintf("key-%02d", i)] = []byte(fmt.Sprintf("val-%d", i))
+	}
+	if err := kv.PutMany(data); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	return kv
+}
+
+func TestScan(t *testing.T) {
+	kv := newScanTestKV(t, 10)
+
+	entries, next, err := kv.Scan("key-02", "key-08", 4)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got: %d", len(entries))
+	}
+	if entries[0].Key != "key-02" || entries[3].Key != "key-05" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if string(entries[0].Value) != "val-2" {
+		t.Errorf("expected 'val-2' but got: %s", string(entries[0].Value))
+	}
+	if next != "key-06" {
+		t.Errorf("expected next to be 'key-06', got: %s", next)
+	}
+
+	entries, next, err = kv.Scan(next, "key-08", 4)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	if len(entries) != 2 || entries[1].Key != "key-07" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if next != "" {
+		t.Errorf("expected scan to be finished, got next: %s", next)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	kv := newScanTestKV(t, 12)
+
+	keys, err := kv.Keys("key-1")
+	if err != nil {
+		t.Fatalf("failed to get keys: %s", err)
+	}
+
+	if len(keys) != 2 || keys[0] != "key-10" || keys[1] != "key-11" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	kv := newScanTestKV(t, 5)
+
+	var keys []string
+	it := kv.Iterate("")
+	for it.Next() {
+		keys = append(keys, it.Key())
+		if string(it.Value()) != fmt.Sprintf("val-%d", len(keys)-1) {
+			t.Errorf("unexpected value for %s: %s", it.Key(), string(it.Value()))
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iteration failed: %s", err)
+	}
+
+	if len(keys) != 5 || keys[0] != "key-00" || keys[4] != "key-04" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
@@ -45,7 +45,10 @@ func (s *GobSerializer) Encode(source interface{}) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	// buffer goes back to the pool, result can't share its memory
+	encoded := make([]byte, buf.Len())
+	copy(encoded, buf.Bytes())
+	return encoded, nil
 }
 
 // Decode - decodes given bytes into target struct
@@ -0,0 +1,27 @@
+package kv
+
+import (
+	"testing"
+)
+
+func TestGobSerializerEncodeOwnsResult(t *testing.T) {
+	s := DefaultSerializer()
+
+	first, err := s.Encode(&internalMap{Data: map[string][]byte{"foo": []byte("bar")}})
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	// pooled buffer is reused by the next encode
+	_, err = s.Encode(&internalMap{Data: map[string][]byte{"something": []byte("else entirely")}})
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	var im internalMap
+	if err := s.Decode(first, &im); err != nil {
+		t.Fatalf("failed to decode first result: %s", err)
+	}
+	if string(im.Data["foo"]) != "bar" || len(im.Data) != 1 {
+		t.Errorf("first result was overwritten, got: %v", im.Data)
+	}
+}
@@ -0,0 +1,108 @@
+package kv
+
+import (
+	"errors"
+)
+
+// ErrVersionMismatch is returned by GetObject when stored object has different schema version
+// and Store has no migration hook to handle it.
+var ErrVersionMismatch = errors.New("stored object schema version doesn't match")
+
+// MigrateFunc converts object data stored with an older (or newer) schema version into out.
+type MigrateFunc func(key string, version int, data []byte, out interface{}) error
+
+// StoreOption configures Store.
+type StoreOption func(*Store)
+
+// WithSchemaVersion tags objects written by the Store with schema version. Bump it when shape of
+// stored structs changes in incompatible way.
+func WithSchemaVersion(version int) StoreOption {
+	return func(s *Store) {
+		s.version = version
+	}
+}
+
+// WithMigration sets hook that is called by GetObject for objects stored with different schema version.
+func WithMigration(fn MigrateFunc) StoreOption {
+	return func(s *Store) {
+		s.migrate = fn
+	}
+}
+
+// objectEnvelope wraps encoded object together with its schema version.
+type objectEnvelope struct {
+	Version int
+	Data    []byte
+}
+
+// Store saves structured values in a bucket, values are encoded with bucket's serializer so callers
+// don't have to encode their structs before Put.
+type Store struct {
+	kv      *KV
+	version int
+	migrate MigrateFunc
+}
+
+// NewStore creates a Store on top of the bucket.
+func NewStore(kv *KV, opts ...StoreOption) *Store {
+	s := &Store{kv: kv}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// PutObject encodes v and saves it under key.
+func (s *Store) PutObject(key string, v interface{}) error {
+	data, err := s.kv.serializer.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := s.kv.serializer.Encode(&objectEnvelope{
+		Version: s.version,
+		Data:    data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Put(key, encoded)
+}
+
+// GetObject retrieves value stored under key and decodes it into out which has to be a pointer. ErrNotFound is
+// returned if key doesn't exist. Objects with different schema version are passed to migration hook.
+func (s *Store) GetObject(key string, out interface{}) error {
+	encoded, err := s.kv.Get(key)
+	if err != nil {
+		return err
+	}
+
+	var envelope objectEnvelope
+	if err := s.kv.serializer.Decode(encoded, &envelope); err != nil {
+		return err
+	}
+
+	if envelope.Version != s.version {
+		if s.migrate == nil {
+			return ErrVersionMismatch
+		}
+		return s.migrate(key, envelope.Version, envelope.Data, out)
+	}
+
+	return s.kv.serializer.Decode(envelope.Data, out)
+}
+
+// Version returns schema version of the object stored under key.
+func (s *Store) Version(key string) (int, error) {
+	encoded, err := s.kv.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var envelope objectEnvelope
+	if err := s.kv.serializer.Decode(encoded, &envelope); err != nil {
+		return 0, err
+	}
+	return envelope.Version, nil
+}
@@ -0,0 +1,76 @@
+package kv
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+type userV1 struct {
+	Name string
+}
+
+type userV2 struct {
+	FirstName string
+	LastName  string
+}
+
+func TestStoreObjects(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "users")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	store := NewStore(kv, WithSchemaVersion(1))
+
+	err = store.PutObject("john", &userV1{Name: "John Doe"})
+	if err != nil {
+		t.Fatalf("failed to put object: %s", err)
+	}
+
+	var u userV1
+	err = store.GetObject("john", &u)
+	if err != nil {
+		t.Fatalf("failed to get object: %s", err)
+	}
+	if u.Name != "John Doe" {
+		t.Errorf("expected 'John Doe' but got: %s", u.Name)
+	}
+
+	err = NewStore(kv, WithSchemaVersion(2)).GetObject("john", &userV2{})
+	if err != ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch, got: %v", err)
+	}
+
+	migrated := NewStore(kv, WithSchemaVersion(2), WithMigration(func(key string, version int, data []byte, out interface{}) error {
+		if version != 1 {
+			t.Errorf("expected version 1, got: %d", version)
+		}
+		var old userV1
+		if err := kv.serializer.Decode(data, &old); err != nil {
+			return err
+		}
+		out.(*userV2).FirstName = old.Name[:4]
+		out.(*userV2).LastName = old.Name[5:]
+		return nil
+	}))
+
+	var u2 userV2
+	err = migrated.GetObject("john", &u2)
+	if err != nil {
+		t.Fatalf("failed to get migrated object: %s", err)
+	}
+	if u2.FirstName != "John" || u2.LastName != "Doe" {
+		t.Errorf("unexpected migrated object: %+v", u2)
+	}
+
+	err = store.GetObject("missing", &u)
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+}
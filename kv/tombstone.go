@@ -0,0 +1,302 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+)
+
+// ErrTombstoneNotFound is returned by Undelete when bucket has no soft deleted copies
+var ErrTombstoneNotFound = errors.New("no deleted copy of the bucket found")
+
+const (
+	// managedByTombstone marks soft deleted buckets
+	managedByTombstone    = "k8s-kv-tombstone"
+	legacyOwnerTombstone  = "K8S-KV-TOMBSTONE"
+	annotationDeletedAt   = "k8s-kv/deleted-at"
+	annotationRetainUntil = "k8s-kv/retain-until"
+	// annotationLabels holds JSON encoded labels of deleted bucket
+	annotationLabels = "k8s-kv/labels"
+	// tombstoneTimeLayout is RFC 3339 with fixed width fractional seconds so timestamps sort as strings
+	tombstoneTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+// maxNameLen is the maximum length of config map names
+const maxNameLen = 253
+
+// suffixedName returns bucket name with the suffix, bucket name is truncated if the result would be too long.
+func suffixedName(bucket, suffix string) string {
+	if len(bucket)+len(suffix) > maxNameLen {
+		bucket = bucket[:maxNameLen-len(suffix)]
+	}
+	return bucket + suffix
+}
+
+// WithSoftDelete makes Teardown keep a copy of deleted bucket (a tombstone config map) for the retention
+// period, bucket can be restored with Undelete until then. Expired tombstones are removed by Teardown
+// of the same bucket and by PurgeTombstones.
+func WithSoftDelete(retention time.Duration) Option {
+	return func(c *config) {
+		c.softDelete = retention
+	}
+}
+
+// TeardownIfEmpty deletes bucket's config map only if bucket has no entries, otherwise ErrBucketNotEmpty
+// is returned.
+func (k *KV) TeardownIfEmpty() (err error) {
+	ctx, end := k.start(OpTeardown)
+	defer end(&err)
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	k.mu.Lock()
+	cfgMap, im, err := k.getInternalMap(ctx)
+	if err == nil && len(im) > 0 {
+		err = ErrBucketNotEmpty
+	}
+	if err == nil {
+		// precondition fails if someone wrote to the bucket after it was read
+		err = k.teardown(cfgMap)
+	}
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpTeardown, "", nil)
+	}
+	return err
+}
+
+// tombstone saves copy of bucket's config map that can be restored by Undelete.
+func (k *KV) tombstone(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	original, err := json.Marshal(cfgMap.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var lbs labels
+	lbs.init()
+	lbs.fromMap(cfgMap.Labels)
+	// different manager so tombstones don't show up as buckets
+	lbs.set(labelManagedBy, managedByTombstone)
+	lbs.set(labelBucket, k.bucket)
+	if _, ok := lbs[legacyLabelOwner]; ok {
+		lbs.set(legacyLabelOwner, legacyOwnerTombstone)
+	}
+
+	now := time.Now()
+	annotations := make(map[string]string, len(cfgMap.Annotations)+3)
+	for key, val := range cfgMap.Annotations {
+		annotations[key] = val
+	}
+	annotations[annotationDeletedAt] = now.UTC().Format(tombstoneTimeLayout)
+	annotations[annotationRetainUntil] = now.Add(k.softDelete).UTC().Format(tombstoneTimeLayout)
+	annotations[annotationLabels] = string(original)
+
+	tombstone := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            suffixedName(k.bucket, fmt.Sprintf("-deleted-%d", now.UnixNano())),
+			Labels:          lbs.toMap(),
+			Annotations:     annotations,
+			OwnerReferences: cfgMap.OwnerReferences,
+		},
+		Data:       cfgMap.Data,
+		BinaryData: cfgMap.BinaryData,
+	}
+
+	created, err := k.implementer.Create(tombstone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save deleted bucket copy: %s", err)
+	}
+
+	if tombstones, err := k.tombstones(); err == nil {
+		purgeExpired(k.implementer, tombstones, now)
+	}
+	return created, nil
+}
+
+// tombstones returns soft deleted copies of the bucket, the latest one first.
+func (k *KV) tombstones() ([]v1.ConfigMap, error) {
+	var set labels
+	set.init()
+	set.set(labelManagedBy, managedByTombstone)
+	set.set(labelBucket, k.bucket)
+
+	cfgMaps, err := k.implementer.List(meta_v1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(k8slabels.Set(set.toMap())).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tombstones []v1.ConfigMap
+	for _, cfgMap := range cfgMaps.Items {
+		var lbs labels
+		lbs.init()
+		lbs.fromMap(cfgMap.Labels)
+		if lbs.match(set) {
+			tombstones = append(tombstones, cfgMap)
+		}
+	}
+
+	// timestamps in UTC sort chronologically
+	sort.Slice(tombstones, func(i, j int) bool {
+		return tombstones[i].Annotations[annotationDeletedAt] > tombstones[j].Annotations[annotationDeletedAt]
+	})
+	return tombstones, nil
+}
+
+// Undelete restores the latest soft deleted copy of the bucket (see WithSoftDelete). Empty bucket that was
+// recreated in the meantime (ie: by a read through a handle that isn't strict) is replaced, ErrBucketExists
+// is returned if recreated bucket has entries.
+func (k *KV) Undelete() (err error) {
+	_, end := k.start(OpUndelete)
+	defer end(&err)
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	k.mu.Lock()
+	err = k.undelete()
+	k.mu.Unlock()
+
+	if err == nil {
+		k.audit(OpUndelete, "", nil)
+	}
+	return err
+}
+
+// undelete restores the latest tombstone, k.mu has to be held.
+func (k *KV) undelete() error {
+	tombstones, err := k.tombstones()
+	if err != nil {
+		return err
+	}
+	if len(tombstones) == 0 {
+		return ErrTombstoneNotFound
+	}
+	tombstone := tombstones[0]
+
+	var lbs map[string]string
+	if err := json.Unmarshal([]byte(tombstone.Annotations[annotationLabels]), &lbs); err != nil {
+		return fmt.Errorf("failed to decode labels of deleted bucket: %s", err)
+	}
+
+	annotations := make(map[string]string)
+	for key, val := range tombstone.Annotations {
+		switch key {
+		case annotationDeletedAt, annotationRetainUntil, annotationLabels:
+		default:
+			annotations[key] = val
+		}
+	}
+
+	restored := &v1.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:            k.bucket,
+			Labels:          lbs,
+			Annotations:     annotations,
+			OwnerReferences: tombstone.OwnerReferences,
+		},
+		Data:       tombstone.Data,
+		BinaryData: tombstone.BinaryData,
+	}
+
+	created, err := k.implementer.Create(restored)
+	if apierrors.IsAlreadyExists(err) {
+		created, err = k.replaceEmpty(restored)
+	}
+	if err != nil {
+		return err
+	}
+	if k.cache != nil {
+		k.cache.invalidate()
+	}
+	k.observe(created)
+
+	k.implementer.Delete(tombstone.Name, &meta_v1.DeleteOptions{
+		Preconditions: &meta_v1.Preconditions{UID: &tombstone.UID},
+	})
+
+	k.event(created, v1.EventTypeNormal, ReasonBucketUndeleted, "bucket '%s' of app '%s' was restored from '%s'", k.bucket, k.app, tombstone.Name)
+	return nil
+}
+
+// replaceEmpty replaces existing bucket's config map with restored one if bucket has no entries.
+func (k *KV) replaceEmpty(restored *v1.ConfigMap) (*v1.ConfigMap, error) {
+	existing, err := k.implementer.Get(k.bucket, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	im, err := decodeConfigMap(k.serializer, existing)
+	if err != nil || len(im) > 0 || len(existing.Data) > 1 || len(existing.BinaryData) > 0 {
+		return nil, ErrBucketExists
+	}
+
+	// update fails if bucket was written to or recreated since it was checked
+	restored.UID = existing.UID
+	restored.ResourceVersion = existing.ResourceVersion
+	updated, err := k.implementer.Update(restored)
+	if apierrors.IsConflict(err) {
+		return nil, ErrBucketExists
+	}
+	return updated, err
+}
+
+// PurgeTombstones deletes soft deleted buckets of the app whose retention period is over, it returns the
+// number of deleted tombstones. If app is empty - tombstones of all apps are purged.
+func PurgeTombstones(implementer ConfigMapInterface, app string) (int, error) {
+	var set labels
+	set.init()
+	set.set(labelManagedBy, managedByTombstone)
+
+	cfgMaps, err := implementer.List(meta_v1.ListOptions{
+		LabelSelector: k8slabels.SelectorFromSet(k8slabels.Set(set.toMap())).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var tombstones []v1.ConfigMap
+	for _, cfgMap := range cfgMaps.Items {
+		var lbs labels
+		lbs.init()
+		lbs.fromMap(cfgMap.Labels)
+		if !lbs.match(set) {
+			continue
+		}
+		if app != "" && lbs.get(labelApp) != app && lbs.get(legacyLabelApp) != app {
+			continue
+		}
+		tombstones = append(tombstones, cfgMap)
+	}
+
+	return purgeExpired(implementer, tombstones, time.Now())
+}
+
+func purgeExpired(implementer ConfigMapInterface, tombstones []v1.ConfigMap, now time.Time) (int, error) {
+	var purged int
+	for _, tombstone := range tombstones {
+		retainUntil, err := time.Parse(tombstoneTimeLayout, tombstone.Annotations[annotationRetainUntil])
+		if err != nil || now.Before(retainUntil) {
+			continue
+		}
+		err = implementer.Delete(tombstone.Name, &meta_v1.DeleteOptions{
+			Preconditions: &meta_v1.Preconditions{UID: &tombstone.UID},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTeardownPreconditions(t *testing.T) {
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "b1", UID: "uid-1", ResourceVersion: "42"},
+			Data:       map[string]string{},
+		},
+	}
+
+	kv, err := New(fi, "app", "b1")
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+	if err := kv.Teardown(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+
+	preconditions := fi.deletedOptions.Preconditions
+	if preconditions == nil || *preconditions.UID != "uid-1" || *preconditions.ResourceVersion != "42" {
+		t.Errorf("unexpected delete preconditions: %+v", preconditions)
+	}
+}
+
+func TestTeardownMissing(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	db, _ := Open(impl, "app")
+	defer db.Close()
+
+	if err := db.DeleteBucket("missing"); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+
+	kv, _ := New(impl, "app", "b1")
+	impl.Delete("b1", &meta_v1.DeleteOptions{})
+	if err := kv.Teardown(); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+}
+
+func TestTeardownIfEmpty(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	kv, _ := New(impl, "app", "b1")
+
+	kv.Put("foo", []byte("bar"))
+	if err := kv.TeardownIfEmpty(); err != ErrBucketNotEmpty {
+		t.Errorf("expected bucket not empty error, got: %v", err)
+	}
+
+	kv.Delete("foo")
+	if err := kv.TeardownIfEmpty(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+	if exists, _ := kv.Exists(); exists {
+		t.Errorf("expected bucket to be deleted")
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	kv, _ := New(impl, "app", "b1", WithSoftDelete(time.Hour), WithStrict())
+	if _, err := CreateBucket(impl, "app", "b1"); err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+
+	kv.Put("foo", []byte("bar"))
+	if err := kv.Teardown(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+	if _, err := kv.Get("foo"); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found error, got: %v", err)
+	}
+
+	buckets, _ := ListBuckets(impl, "app")
+	if len(buckets) != 0 {
+		t.Errorf("tombstone shouldn't be listed as a bucket: %+v", buckets)
+	}
+
+	if err := kv.Undelete(); err != nil {
+		t.Fatalf("failed to undelete: %s", err)
+	}
+	val, err := kv.Get("foo")
+	if err != nil || string(val) != "bar" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+	cfgMap, _ := impl.Get("b1", meta_v1.GetOptions{})
+	if cfgMap.Labels[labelManagedBy] != managedByK8SKV || cfgMap.Annotations[annotationDeletedAt] != "" {
+		t.Errorf("unexpected restored config map: %v %v", cfgMap.Labels, cfgMap.Annotations)
+	}
+
+	if err := kv.Undelete(); err != ErrTombstoneNotFound {
+		t.Errorf("expected tombstone not found error, got: %v", err)
+	}
+
+	kv.softDelete = time.Millisecond
+	kv.Teardown()
+	time.Sleep(5 * time.Millisecond)
+	purged, err := PurgeTombstones(impl, "app")
+	if err != nil {
+		t.Fatalf("failed to purge: %s", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged tombstone, got: %d", purged)
+	}
+}
+
+func TestUndeleteAutoCreated(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	kv, _ := New(impl, "app", "b1", WithSoftDelete(time.Hour))
+
+	kv.Put("foo", []byte("bar"))
+	if err := kv.Teardown(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+	// read recreates empty bucket
+	if _, err := kv.Get("foo"); err != ErrNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+
+	if err := kv.Undelete(); err != nil {
+		t.Fatalf("failed to undelete: %s", err)
+	}
+	val, err := kv.Get("foo")
+	if err != nil || string(val) != "bar" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+
+	kv.Teardown()
+	kv.Put("other", []byte("value"))
+	if err := kv.Undelete(); err != ErrBucketExists {
+		t.Errorf("expected bucket exists error, got: %v", err)
+	}
+}
+
+func TestTombstoneLongName(t *testing.T) {
+	impl := fake.NewSimpleClientset().CoreV1().ConfigMaps("default")
+	bucket := strings.Repeat("b", 250)
+	kv, _ := New(impl, "app", bucket, WithSoftDelete(time.Hour))
+
+	kv.Put("foo", []byte("bar"))
+	if err := kv.Teardown(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+	tombstones, _ := kv.tombstones()
+	if len(tombstones) != 1 || len(tombstones[0].Name) > maxNameLen {
+		t.Fatalf("unexpected tombstones: %+v", tombstones)
+	}
+
+	if err := kv.Undelete(); err != nil {
+		t.Fatalf("failed to undelete: %s", err)
+	}
+	if val, err := kv.Get("foo"); err != nil || string(val) != "bar" {
+		t.Errorf("unexpected value: %s, %v", val, err)
+	}
+}
+
+func TestTeardownObserved(t *testing.T) {
+	impl := newFakeAPIServer()
+	kv, _ := New(impl, "app", "b1")
+	kv.Put("foo", []byte("bar"))
+
+	// bucket recreated by someone else after it was read
+	other, _ := New(impl, "app", "b1")
+	other.Teardown()
+	other.Put("foo", []byte("new"))
+	if err := kv.Teardown(); !apierrors.IsConflict(err) {
+		t.Fatalf("expected conflict error, got: %v", err)
+	}
+
+	// modified by someone else after it was read
+	kv.Get("foo")
+	other.Put("foo", []byte("newer"))
+	if err := kv.Teardown(); !apierrors.IsConflict(err) {
+		t.Fatalf("expected conflict error, got: %v", err)
+	}
+	if exists, _ := kv.Exists(); !exists {
+		t.Fatalf("expected bucket to be kept")
+	}
+
+	kv.Get("foo")
+	if err := kv.Teardown(); err != nil {
+		t.Fatalf("failed to teardown: %s", err)
+	}
+}
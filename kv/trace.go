@@ -0,0 +1,64 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/rusenask/k8s-kv/kv"
+
+// WithTracerProvider enables OpenTelemetry tracing. Every operation gets a span with child spans
+// for fetching, decoding, encoding and saving bucket's config map.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithContext returns a shallow copy of KV that starts operation spans from ctx, use it to connect
+// bucket operations to request's trace:
+//
+//	val, err := kvdb.WithContext(r.Context()).Get("foo")
+//
+// Copy shares bucket's lock, cache and settings with the original KV.
+func (k *KV) WithContext(ctx context.Context) *KV {
+	c := *k
+	c.ctx = ctx
+	return &c
+}
+
+// start begins operation of the bucket, returned func has to be deferred with a pointer to operation's error.
+func (k *KV) start(op Op) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := k.startSpan(k.ctx, string(op))
+
+	return ctx, func(err *error) {
+		k.metrics.observeOperation(k.bucket, op, start, *err)
+		// missing keys are not operation failures
+		if *err == ErrNotFound {
+			span.End()
+			return
+		}
+		endSpan(span, *err)
+	}
+}
+
+func (k *KV) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return k.tracer.Start(ctx, "k8s-kv."+name, trace.WithAttributes(
+		attribute.String("k8s_kv.bucket", k.bucket),
+		attribute.String("k8s_kv.app", k.app),
+	))
+}
+
+// endSpan records error (if any) and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/api/core/v1"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1", WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	err = kv.WithContext(ctx).Put("foo", []byte("bar"))
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	put, ok := spans["k8s-kv.put"]
+	if !ok {
+		t.Fatalf("expected put span, got: %v", spans)
+	}
+	if put.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected put span to be a child of request span")
+	}
+
+	for _, name := range []string{"k8s-kv.fetch", "k8s-kv.decode", "k8s-kv.encode", "k8s-kv.save"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != put.SpanContext().SpanID() {
+			t.Errorf("expected %s span to be a child of put span", name)
+		}
+	}
+
+	var bucket string
+	for _, attr := range put.Attributes() {
+		if attr.Key == "k8s_kv.bucket" {
+			bucket = attr.Value.AsString()
+		}
+	}
+	if bucket != "b1" {
+		t.Errorf("expected bucket attribute to be 'b1', got: %s", bucket)
+	}
+}
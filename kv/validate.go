@@ -0,0 +1,72 @@
+package kv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidatorFunc checks value before it's written under key, returned error rejects the write.
+type ValidatorFunc func(key string, value []byte) error
+
+// ValidationError is returned by write operations when a value is rejected by a validator.
+type ValidationError struct {
+	Key string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid value for key '%s': %s", e.Key, e.Err)
+}
+
+type validator struct {
+	prefix string
+	fn     ValidatorFunc
+}
+
+// WithValidator registers validator for keys starting with prefix (empty prefix matches all keys). Validators
+// are called by Put, PutMany, Incr, Replicator and DB.Merge before bucket is saved, if any of the values
+// is rejected nothing is written.
+func WithValidator(prefix string, fn ValidatorFunc) Option {
+	return func(c *config) {
+		c.validators = append(c.validators, validator{prefix: prefix, fn: fn})
+	}
+}
+
+// validate runs all validators registered for the key.
+func (k *KV) validate(key string, value []byte) error {
+	for _, v := range k.validators {
+		if !strings.HasPrefix(key, v.prefix) {
+			continue
+		}
+		if err := v.fn(key, value); err != nil {
+			return &ValidationError{Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+// JSONSchemaValidator returns validator that requires values to be JSON documents valid against the schema.
+func JSONSchemaValidator(schema []byte) (ValidatorFunc, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(key string, value []byte) error {
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(value))
+		if err != nil {
+			return err
+		}
+		if result.Valid() {
+			return nil
+		}
+
+		var msgs []string
+		for _, e := range result.Errors() {
+			msgs = append(msgs, e.String())
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}, nil
+}
@@ -0,0 +1,65 @@
+package kv
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestValidators(t *testing.T) {
+	userSchema, err := JSONSchemaValidator([]byte(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatalf("failed to compile schema: %s", err)
+	}
+
+	fi := &fakeImplementer{
+		getcfgMap: &v1.ConfigMap{
+			Data: map[string]string{},
+		},
+	}
+	kv, err := New(fi, "app", "b1",
+		WithValidator("users/", userSchema),
+		WithValidator("", func(key string, value []byte) error {
+			if len(value) > 32 {
+				return errors.New("value too long")
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to get kv: %s", err)
+	}
+
+	err = kv.Put("users/john", []byte(`{"name": "John"}`))
+	if err != nil {
+		t.Errorf("expected valid user to be saved, got: %s", err)
+	}
+
+	err = kv.Put("users/jane", []byte(`{"age": 30}`))
+	if verr, ok := err.(*ValidationError); !ok || verr.Key != "users/jane" {
+		t.Errorf("expected validation error for users/jane, got: %v", err)
+	}
+
+	err = kv.Put("other", []byte("not json"))
+	if err != nil {
+		t.Errorf("expected value outside of users/ to skip schema, got: %s", err)
+	}
+
+	err = kv.PutMany(map[string][]byte{
+		"a": []byte("short"),
+		"b": []byte("this value is longer than thirty two bytes"),
+	})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("expected validation error, got: %v", err)
+	}
+
+	_, err = kv.Get("a")
+	if err != ErrNotFound {
+		t.Errorf("expected rejected batch not to be written, got: %v", err)
+	}
+}
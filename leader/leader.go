@@ -0,0 +1,182 @@
+/*
+Package leader implements leader election on top of k8s-kv buckets. Candidates compete for a lock stored
+in a bucket key, the one holding it is the leader until it stops renewing its lease. It's meant for small
+services where only one replica should do the work (ie: run cron jobs):
+
+	elector, err := leader.New(leader.Config{
+		Bucket:        kvdb,
+		Key:           "leader/cron",
+		Identity:      podName,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		Callbacks: leader.Callbacks{
+			OnStartedLeading: func(ctx context.Context) { runJobs(ctx) },
+			OnStoppedLeading: func() { log.Println("stopped leading") },
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	elector.Run(ctx)
+*/
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rusenask/k8s-kv/kv"
+)
+
+// Callbacks are called when leadership state changes.
+type Callbacks struct {
+	// OnStartedLeading is called in a separate goroutine when this candidate becomes the leader,
+	// context is cancelled once leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when this candidate stops being the leader.
+	OnStoppedLeading func()
+}
+
+// Config of leader election.
+type Config struct {
+	// Bucket where leader lock is stored
+	Bucket *kv.KV
+	// Key of the leader lock in the bucket
+	Key string
+	// Identity of this candidate, has to be unique between candidates (ie: pod name)
+	Identity string
+
+	// LeaseDuration is how long other candidates wait before taking over leadership from
+	// a leader that stopped renewing its lease.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying to renew its lease before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is how often candidates try to acquire leadership and the leader renews its lease.
+	RetryPeriod time.Duration
+
+	Callbacks Callbacks
+}
+
+// Elector runs leader election.
+type Elector struct {
+	cfg    Config
+	locker *kv.Locker
+
+	mu       sync.RWMutex
+	isLeader bool
+}
+
+// New validates config and creates an Elector.
+func New(cfg Config) (*Elector, error) {
+	switch {
+	case cfg.Bucket == nil:
+		return nil, errors.New("bucket is required")
+	case cfg.Key == "":
+		return nil, errors.New("key is required")
+	case cfg.Identity == "":
+		return nil, errors.New("identity is required")
+	case cfg.RetryPeriod <= 0:
+		return nil, errors.New("retry period must be greater than zero")
+	case cfg.RenewDeadline <= cfg.RetryPeriod:
+		return nil, errors.New("renew deadline must be greater than retry period")
+	case cfg.LeaseDuration <= cfg.RenewDeadline:
+		return nil, errors.New("lease duration must be greater than renew deadline")
+	case cfg.Callbacks.OnStartedLeading == nil:
+		return nil, errors.New("OnStartedLeading callback is required")
+	case cfg.Callbacks.OnStoppedLeading == nil:
+		return nil, errors.New("OnStoppedLeading callback is required")
+	}
+
+	locker := kv.NewLocker(cfg.Bucket, cfg.Key, cfg.Identity, cfg.LeaseDuration)
+	// elector renews lease itself to respect renew deadline
+	locker.RenewInterval = 0
+
+	return &Elector{
+		cfg:    cfg,
+		locker: locker,
+	}, nil
+}
+
+// Run starts leader election loop. It blocks until context is done or leadership is lost after it was
+// acquired. Leadership is released when context is cancelled so other candidates can take over right away.
+func (e *Elector) Run(ctx context.Context) {
+	if !e.acquire(ctx) {
+		return
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.setLeader(true)
+	go e.cfg.Callbacks.OnStartedLeading(leaderCtx)
+
+	e.renew(leaderCtx)
+
+	cancel()
+	e.setLeader(false)
+	e.cfg.Callbacks.OnStoppedLeading()
+
+	if ctx.Err() != nil {
+		e.locker.Unlock()
+	}
+}
+
+// IsLeader returns true while this candidate is the leader.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isLeader
+}
+
+// Leader returns identity of the current leader or empty string if there's no leader.
+func (e *Elector) Leader() (string, error) {
+	return e.locker.Owner()
+}
+
+// acquire tries to become the leader until it succeeds or context is done.
+func (e *Elector) acquire(ctx context.Context) bool {
+	for {
+		// errors are transient from candidate's point of view, it just keeps trying
+		acquired, err := e.locker.TryLock()
+		if err == nil && acquired {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(e.cfg.RetryPeriod):
+		}
+	}
+}
+
+// renew keeps renewing leader's lease until context is done or lease can't be renewed within renew deadline.
+func (e *Elector) renew(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.RetryPeriod)
+	defer ticker.Stop()
+
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := e.locker.Renew()
+		if err == nil {
+			lastRenew = time.Now()
+			continue
+		}
+		if err == kv.ErrNotLockOwner || time.Since(lastRenew) > e.cfg.RenewDeadline {
+			return
+		}
+	}
+}
+
+func (e *Elector) setLeader(isLeader bool) {
+	e.mu.Lock()
+	e.isLeader = isLeader
+	e.mu.Unlock()
+}
@@ -0,0 +1,178 @@
+package leader
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rusenask/k8s-kv/kv"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var configMapsResource = schema.GroupResource{Resource: "configmaps"}
+
+// fakeImplementer is an in-memory config map store shared by candidates
+type fakeImplementer struct {
+	mu      sync.Mutex
+	cfgMaps map[string]*v1.ConfigMap
+	version int
+}
+
+func (i *fakeImplementer) Get(name string, options meta_v1.GetOptions) (*v1.ConfigMap, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	cfgMap, ok := i.cfgMaps[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(configMapsResource, name)
+	}
+	return cfgMap.DeepCopy(), nil
+}
+
+func (i *fakeImplementer) Create(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.cfgMaps[cfgMap.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(configMapsResource, cfgMap.Name)
+	}
+	return i.store(cfgMap), nil
+}
+
+func (i *fakeImplementer) Update(cfgMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	existing, ok := i.cfgMaps[cfgMap.Name]
+	if !ok {
+		return nil, apierrors.NewNotFound(configMapsResource, cfgMap.Name)
+	}
+	if existing.ResourceVersion != cfgMap.ResourceVersion {
+		return nil, apierrors.NewConflict(configMapsResource, cfgMap.Name, nil)
+	}
+	return i.store(cfgMap), nil
+}
+
+func (i *fakeImplementer) store(cfgMap *v1.ConfigMap) *v1.ConfigMap {
+	i.version++
+	stored := cfgMap.DeepCopy()
+	stored.ResourceVersion = strconv.Itoa(i.version)
+	i.cfgMaps[stored.Name] = stored
+	return stored.DeepCopy()
+}
+
+func (i *fakeImplementer) Delete(name string, options *meta_v1.DeleteOptions) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.cfgMaps, name)
+	return nil
+}
+
+func (i *fakeImplementer) List(opts meta_v1.ListOptions) (*v1.ConfigMapList, error) {
+	return &v1.ConfigMapList{}, nil
+}
+
+func (i *fakeImplementer) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+type candidate struct {
+	elector *Elector
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func newCandidate(t *testing.T, impl *fakeImplementer, identity string) *candidate {
+	bucket, err := kv.New(impl, "test", "leader")
+	if err != nil {
+		t.Fatalf("failed to create kv: %s", err)
+	}
+
+	c := &candidate{
+		started: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	c.elector, err = New(Config{
+		Bucket:        bucket,
+		Key:           "leader",
+		Identity:      identity,
+		LeaseDuration: 300 * time.Millisecond,
+		RenewDeadline: 200 * time.Millisecond,
+		RetryPeriod:   20 * time.Millisecond,
+		Callbacks: Callbacks{
+			OnStartedLeading: func(ctx context.Context) { close(c.started) },
+			OnStoppedLeading: func() { close(c.stopped) },
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create elector: %s", err)
+	}
+	return c
+}
+
+func waitFor(t *testing.T, ch chan struct{}, what string) {
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestElection(t *testing.T) {
+	impl := &fakeImplementer{cfgMaps: make(map[string]*v1.ConfigMap)}
+
+	a := newCandidate(t, impl, "pod-a")
+	b := newCandidate(t, impl, "pod-b")
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	go a.elector.Run(ctxA)
+	waitFor(t, a.started, "pod-a to start leading")
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go b.elector.Run(ctxB)
+
+	// pod-a keeps renewing its lease so pod-b shouldn't take over
+	time.Sleep(400 * time.Millisecond)
+	if b.elector.IsLeader() {
+		t.Fatalf("expected pod-b not to be the leader")
+	}
+	if !a.elector.IsLeader() {
+		t.Fatalf("expected pod-a to be the leader")
+	}
+
+	current, err := b.elector.Leader()
+	if err != nil {
+		t.Fatalf("failed to get leader: %s", err)
+	}
+	if current != "pod-a" {
+		t.Errorf("expected 'pod-a' to be the leader, got: %s", current)
+	}
+
+	cancelA()
+	waitFor(t, a.stopped, "pod-a to stop leading")
+	waitFor(t, b.started, "pod-b to start leading")
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, err := New(Config{
+		Bucket:        &kv.KV{},
+		Key:           "leader",
+		Identity:      "pod-a",
+		LeaseDuration: time.Second,
+		RenewDeadline: 2 * time.Second,
+		RetryPeriod:   100 * time.Millisecond,
+		Callbacks: Callbacks{
+			OnStartedLeading: func(ctx context.Context) {},
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err == nil {
+		t.Errorf("expected error when lease duration is shorter than renew deadline")
+	}
+}